@@ -3,6 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/zcubbs/rgo/pkg/argocd"
@@ -12,38 +16,205 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	serverSide     bool
+	forceConflicts bool
+	prune          bool
+	pruneDryRun    bool
+	assumeYes      bool
+	wait           bool
+	waitTimeout    time.Duration
+	parallel       int
+	objectTimeout  time.Duration
+	alwaysUpdate   bool
+)
+
 var applyCmd = &cobra.Command{
 	Use:   "apply",
-	Short: "Apply all resources from config (projects, repos/creds, applications)",
+	Short: "Apply all resources from config (projects, repos/creds, applications, application sets)",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.Load()
+		cfg, err := loadValidConfig()
 		if err != nil {
 			return err
 		}
 
-		var objs []k8s.Object
-		objs = append(objs, argocd.BuildProjects(cfg.Projects, namespace)...)
-		objs = append(objs, argocd.BuildRepoSecrets(cfg.Repositories, namespace)...)
-		objs = append(objs, argocd.BuildCredentialSecrets(cfg.Credentials, namespace)...)
-		objs = append(objs, argocd.BuildApplications(cfg.Applications, namespace)...)
+		targets, err := resolveTargets(cfg)
+		if err != nil {
+			return err
+		}
 
 		if dryRun {
-			return k8s.PrintObjects(objs, output)
+			for _, t := range targets {
+				if t.name != "" {
+					fmt.Fprintf(os.Stderr, "# target %s (namespace %s)\n", t.name, t.ns)
+				}
+				if err := k8s.PrintObjects(t.objs, output); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if prune && !pruneDryRun && !assumeYes && len(targets) > 1 {
+			return fmt.Errorf("--prune across several targets cannot prompt for confirmation; review with --prune-dry-run, then pass --yes")
 		}
 
-		client, err := k8s.New()
-		if err != nil {
-			return err
+		if len(targets) == 1 {
+			return applyTarget(targets[0], cfg.APIRetry, targetOutput(targets[0]))
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
-		defer cancel()
 
-		for _, obj := range objs {
-			if err := client.Apply(ctx, obj); err != nil {
-				return err
+		// targets are independent Argo CD instances: one failing must not stop the others
+		errs := make([]error, len(targets))
+		var wg sync.WaitGroup
+		for i, t := range targets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = applyTarget(t, cfg.APIRetry, targetOutput(t))
+			}()
+		}
+		wg.Wait()
+
+		failed := 0
+		fmt.Println("Targets:")
+		for i, t := range targets {
+			if errs[i] != nil {
+				failed++
+				fmt.Printf("  %s: failed: %v\n", t.name, errs[i])
+			} else {
+				fmt.Printf("  %s: ok\n", t.name)
 			}
 		}
-		fmt.Println("Applied successfully")
+		if failed > 0 {
+			return fmt.Errorf("%d of %d targets failed", failed, len(targets))
+		}
 		return nil
 	},
 }
+
+// applyTarget applies, prunes and waits for the objects of one target,
+// writing progress to out
+func applyTarget(t target, retry *config.APIRetry, out io.Writer) error {
+	client, err := k8s.New(k8s.Options{
+		ServerSide:     serverSide,
+		ForceConflicts: forceConflicts,
+		AlwaysUpdate:   alwaysUpdate,
+		PreserveLive:   argocd.PreserveRoleTokens,
+		Retry:          retryPolicy(retry, out),
+		Connection:     t.conn,
+	})
+	if err != nil {
+		return err
+	}
+	if err := migrateCredentials(client, t.ns, t.objs, out); err != nil {
+		return err
+	}
+
+	exec := &k8s.Executor{
+		Client:   client,
+		Parallel: parallel,
+		Timeout:  objectTimeout,
+		Skip:     argocd.SkipDependent,
+		OnResult: func(r k8s.Result) {
+			ref := r.Object.Obj.GetKind() + "/" + r.Object.Obj.GetName()
+			switch {
+			case r.Skipped != "":
+				fmt.Fprintf(out, "skipped %s: %s\n", ref, r.Skipped)
+			case r.Err != nil:
+				fmt.Fprintf(out, "failed %s: %v\n", ref, r.Err)
+			case r.Unchanged:
+				fmt.Fprintf(out, "unchanged %s\n", ref)
+			default:
+				fmt.Fprintf(out, "applied %s (%s)\n", ref, r.Duration.Round(time.Millisecond))
+			}
+		},
+	}
+	// objects get their own timeouts; the run as a whole has none
+	applied := time.Now()
+	if err := applyReport(exec.Run(context.Background(), argocd.ApplyStages(t.objs)), out); err != nil {
+		return err
+	}
+
+	if prune || pruneDryRun {
+		if err := pruneOrphans(client, t.ns, t.objs, out); err != nil {
+			return err
+		}
+	}
+
+	if wait {
+		waitCtx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+		return waitForApplications(waitCtx, client, t.objs, applied, out)
+	}
+	return nil
+}
+
+// applyReport summarises an executor run and returns an error listing every
+// object that was not applied
+func applyReport(results []k8s.Result, out io.Writer) error {
+	var applied, unchanged, skipped int
+	var failures []string
+	for _, r := range results {
+		ref := r.Object.Obj.GetKind() + "/" + r.Object.Obj.GetName()
+		switch {
+		case r.Skipped != "":
+			skipped++
+			failures = append(failures, fmt.Sprintf("%s: skipped: %s", ref, r.Skipped))
+		case r.Err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", ref, r.Err))
+		case r.Unchanged:
+			unchanged++
+		default:
+			applied++
+		}
+	}
+	fmt.Fprintf(out, "%d applied, %d unchanged, %d failed, %d skipped\n", applied, unchanged, len(failures)-skipped, skipped)
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d objects not applied:\n  %s", len(failures), len(results), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+func init() {
+	applyCmd.Flags().BoolVar(&serverSide, "server-side", true, "Use server-side apply; set to false to fall back to get + create/update on old clusters")
+	applyCmd.Flags().BoolVar(&forceConflicts, "force-conflicts", false, "Take ownership of fields managed by other field managers during server-side apply")
+	applyCmd.Flags().BoolVar(&alwaysUpdate, "always-update", false, "Write every object even when the live object already matches the config")
+	applyCmd.Flags().BoolVar(&prune, "prune", false, "Delete rgo-managed resources that are no longer in the config")
+	applyCmd.Flags().BoolVar(&pruneDryRun, "prune-dry-run", false, "List the resources --prune would delete without deleting them")
+	applyCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Skip the prune confirmation prompt")
+	applyCmd.Flags().BoolVar(&wait, "wait", false, "Wait until every applied application is synced and healthy")
+	applyCmd.Flags().IntVar(&parallel, "parallel", 4, "Objects applied concurrently; raise --qps and --burst along with it")
+	applyCmd.Flags().DurationVar(&objectTimeout, "object-timeout", 30*time.Second, "Timeout for applying a single object")
+	applyCmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 5*time.Minute, "How long --wait waits for applications")
+}
+
+// migrateCredentials relabels credential secrets that older rgo versions
+// labelled as repositories. The secret keeps its name, so the executor then
+// applies the rest of the repo-creds form over it, and a failing apply leaves
+// the old credentials in place.
+func migrateCredentials(client *k8s.Client, ns string, objs []k8s.Object, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	live, err := client.List(ctx, argocd.GVRSecret, ns, argocd.ManagedSelector)
+	if err != nil {
+		return fmt.Errorf("list secrets: %w", err)
+	}
+	for _, o := range argocd.MislabeledCredentials(live, objs) {
+		fmt.Fprintf(out, "migrating credential secret %s to repo-creds\n", o.Obj.GetName())
+		if err := client.Label(ctx, o, argocd.SecretTypeLabel, "repo-creds"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildObjects renders every resource described by the config, in apply order
+func buildObjects(cfg config.Config, ns string) []k8s.Object {
+	var objs []k8s.Object
+	objs = append(objs, argocd.BuildProjects(cfg.Projects, ns)...)
+	objs = append(objs, argocd.BuildRepoSecrets(cfg.Repositories, ns)...)
+	objs = append(objs, argocd.BuildCredentialSecrets(cfg.Credentials, ns)...)
+	objs = append(objs, argocd.BuildClusterSecrets(cfg.Clusters, ns)...)
+	objs = append(objs, argocd.BuildApplications(cfg.Applications, ns)...)
+	objs = append(objs, argocd.BuildApplicationSets(cfg.ApplicationSets, ns)...)
+	return objs
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	clusterKubeconfig       string
+	clusterContext          string
+	clusterName             string
+	clusterNamespaces       []string
+	clusterResources        bool
+	clusterProject          string
+	clusterLabels           map[string]string
+	clusterServiceAccount   bool
+	clusterSANamespace      string
+	clusterSAName           string
+	clusterRole             string
+	clusterWriteConfig      bool
+	clusterEnvFile          string
+	clusterTokenWaitTimeout time.Duration
+)
+
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Manage the clusters Argo CD deploys to",
+}
+
+var clusterAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Register a kubeconfig context as an Argo CD cluster",
+	Long: `Register a kubeconfig context as an Argo CD cluster.
+
+The server, CA and credentials (token, client certificate or exec plugin) are
+read from the kubeconfig. With --service-account, a ServiceAccount, a
+ClusterRoleBinding and a token secret are created in the registered cluster
+and Argo CD authenticates with that token instead.
+
+The cluster secret is applied to the Argo CD namespace, printed with --dry-run,
+or appended to the config file with --write-config. Credentials written to
+the config file, including the environment of an exec plugin, are replaced by
+${ENV} placeholders, whose values are stored in --env-file with mode 0600.
+
+A secret applied directly is not labelled managed-by=rgo: apply --prune leaves
+it alone and status does not list it. Use --write-config to manage the cluster
+from the config instead.
+
+--project must name a project declared in the config, or "default".
+
+Here --kubeconfig and --context select the cluster being registered; the
+Argo CD cluster is selected with RGO_KUBECONFIG and RGO_CONTEXT.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		restCfg, kubeContext, err := k8s.LoadKubeconfig(clusterKubeconfig, clusterContext)
+		if err != nil {
+			return fmt.Errorf("load kubeconfig: %w", err)
+		}
+		name := clusterName
+		if name == "" {
+			name = dnsName(kubeContext)
+		}
+
+		cluster, err := argocd.ClusterFromRESTConfig(name, restCfg)
+		if err != nil {
+			return fmt.Errorf("context %s: %w", kubeContext, err)
+		}
+		cluster.Namespaces = clusterNamespaces
+		cluster.ClusterResources = clusterResources
+		cluster.Labels = clusterLabels
+
+		if clusterServiceAccount {
+			if dryRun {
+				fmt.Fprintf(os.Stderr, "[dry-run] would create service account %s/%s bound to %s\n", clusterSANamespace, clusterSAName, clusterRole)
+			} else if err := useServiceAccount(&cluster, restCfg, cfg.APIRetry); err != nil {
+				return err
+			}
+		}
+
+		// the projects of the config are what the project must be declared in
+		cluster.Project = clusterProject
+		if err := (config.Config{Projects: cfg.Projects, Clusters: []config.Cluster{cluster}}).Validate(); err != nil {
+			return err
+		}
+
+		if clusterWriteConfig {
+			return writeClusterConfig(cluster)
+		}
+
+		objs := argocd.BuildClusterSecrets([]config.Cluster{cluster}, namespace)
+		// the cluster is not in the config, so apply --prune must not
+		// delete it nor status report it
+		labels := objs[0].Obj.GetLabels()
+		delete(labels, "managed-by")
+		objs[0].Obj.SetLabels(labels)
+		if dryRun {
+			return k8s.PrintObjects(objs, output)
+		}
+		client, err := k8s.New(k8s.Options{ServerSide: true, Retry: retryPolicy(cfg.APIRetry, os.Stderr), Connection: connection()})
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		if _, err := client.Apply(ctx, objs[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Cluster %s (%s) registered as secret %s\n", cluster.Name, cluster.Server, objs[0].Obj.GetName())
+		return nil
+	},
+}
+
+func init() {
+	clusterAddCmd.Flags().StringVar(&clusterKubeconfig, "kubeconfig", "", "Kubeconfig to read the cluster from (default: $KUBECONFIG or ~/.kube/config)")
+	clusterAddCmd.Flags().StringVar(&clusterContext, "context", "", "Kubeconfig context to register (default: current context)")
+	clusterAddCmd.Flags().StringVar(&clusterName, "name", "", "Cluster name in Argo CD (default: the context name)")
+	clusterAddCmd.Flags().StringSliceVar(&clusterNamespaces, "namespaces", nil, "Restrict Argo CD to these namespaces")
+	clusterAddCmd.Flags().BoolVar(&clusterResources, "cluster-resources", false, "Allow cluster-scoped resources when --namespaces is set")
+	clusterAddCmd.Flags().StringVar(&clusterProject, "project", "", "Project the cluster is scoped to")
+	clusterAddCmd.Flags().StringToStringVar(&clusterLabels, "label", nil, "Label for the cluster secret, e.g. --label env=prod")
+	clusterAddCmd.Flags().BoolVar(&clusterServiceAccount, "service-account", false, "Create a ServiceAccount in the cluster and authenticate with its token")
+	clusterAddCmd.Flags().StringVar(&clusterSANamespace, "service-account-namespace", "kube-system", "Namespace of the ServiceAccount created by --service-account")
+	clusterAddCmd.Flags().StringVar(&clusterSAName, "service-account-name", "argocd-manager", "Name of the ServiceAccount created by --service-account")
+	clusterAddCmd.Flags().StringVar(&clusterRole, "cluster-role", "cluster-admin", "ClusterRole bound to the ServiceAccount created by --service-account")
+	clusterAddCmd.Flags().BoolVar(&clusterWriteConfig, "write-config", false, "Append the cluster to the config file instead of applying it")
+	clusterAddCmd.Flags().StringVar(&clusterEnvFile, "env-file", ".env", "Dotenv file receiving the credentials of --write-config")
+	clusterAddCmd.Flags().DurationVar(&clusterTokenWaitTimeout, "token-timeout", 30*time.Second, "How long to wait for the ServiceAccount token")
+
+	clusterCmd.AddCommand(clusterAddCmd)
+}
+
+// useServiceAccount creates the manager ServiceAccount in the registered
+// cluster and switches the cluster credentials to its token
+func useServiceAccount(cluster *config.Cluster, restCfg *rest.Config, retry *config.APIRetry) error {
+	target, err := k8s.NewForConfig(restCfg, k8s.Options{ServerSide: true, Retry: retryPolicy(retry, os.Stderr)})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTokenWaitTimeout+30*time.Second)
+	defer cancel()
+
+	objs := argocd.ClusterManagerObjects(clusterSANamespace, clusterSAName, clusterRole)
+	for _, o := range objs {
+		if _, err := target.Apply(ctx, o); err != nil {
+			return fmt.Errorf("create %s %s: %w", o.Obj.GetKind(), o.Obj.GetName(), err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Created service account %s/%s bound to %s\n", clusterSANamespace, clusterSAName, clusterRole)
+
+	// the token controller fills the secret asynchronously
+	secret := objs[len(objs)-1]
+	deadline := time.Now().Add(clusterTokenWaitTimeout)
+	for {
+		live, err := target.Get(ctx, secret)
+		if err != nil {
+			return err
+		}
+		if token, ca, ok := argocd.ServiceAccountToken(live); ok {
+			tls := config.TLSClientConfig{CAData: ca}
+			if t := cluster.Config.TLSClientConfig; t != nil {
+				tls.ServerName = t.ServerName
+			}
+			cluster.Config = config.ClusterConfig{BearerToken: token, TLSClientConfig: &tls}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for token in secret %s/%s", secret.NS, secret.Obj.GetName())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// writeClusterConfig appends the cluster to the config file, with its
+// credentials moved to environment variables
+func writeClusterConfig(cluster config.Cluster) error {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = cfgFile
+	}
+	if path == "" {
+		path = "config.yaml"
+	}
+	cluster, env := argocd.ClusterPlaceholders(cluster)
+	if dryRun {
+		b, err := config.Marshal(config.Config{Clusters: []config.Cluster{cluster}})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[dry-run] would append to %s:\n%s", path, b)
+	} else {
+		if err := config.AppendCluster(path, cluster); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Added cluster %s to %s\n", cluster.Name, path)
+	}
+
+	if len(env) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(env))
+	for k := range env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	// credentials never go to the terminal, where they would end up in
+	// scrollback and CI logs
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would write %s to %s\n", strings.Join(names, ", "), clusterEnvFile)
+		return nil
+	}
+	if err := writeEnvFile(clusterEnvFile, names, env); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s to %s; it is loaded from the working directory, or export them before running apply\n", strings.Join(names, ", "), clusterEnvFile)
+	return nil
+}
+
+// writeEnvFile sets the variables in a dotenv file readable only by the
+// owner, replacing earlier values of the same variables and keeping other
+// lines
+func writeEnvFile(path string, names []string, env map[string]string) error {
+	var lines []string
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(b) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+			key, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+			if _, ok := env[strings.TrimSpace(key)]; !ok {
+				lines = append(lines, line)
+			}
+		}
+	}
+	for _, k := range names {
+		lines = append(lines, fmt.Sprintf("%s='%s'", k, env[k]))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0o600)
+}
+
+var nonDNS = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// dnsName turns a kubeconfig context name such as an EKS ARN into a valid
+// cluster name
+func dnsName(s string) string {
+	name := strings.Trim(nonDNS.ReplaceAllString(strings.ToLower(s), "-"), "-.")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-.")
+	}
+	return name
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 
 var deleteCmd = &cobra.Command{
 	Use:   "delete [kind] [name]",
-	Short: "Delete a single resource by kind and name (kind: app|project|secret)",
+	Short: "Delete a single resource by kind and name (kind: app|appset|project|secret)",
 	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		kind := strings.ToLower(args[0])
@@ -29,7 +30,11 @@ var deleteCmd = &cobra.Command{
 			return nil
 		}
 
-		client, err := k8s.New()
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		client, err := k8s.New(k8s.Options{Retry: retryPolicy(cfg.APIRetry, os.Stderr), Connection: connection()})
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/diff"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+var noColor bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show differences between the live cluster state and the config",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		targets, err := resolveTargets(cfg)
+		if err != nil {
+			return err
+		}
+		return eachTarget(targets, func(_ int, t target) error {
+			if t.name != "" {
+				fmt.Printf("=== target %s (namespace %s)\n", t.name, t.ns)
+			}
+			return diffTarget(t)
+		})
+	},
+}
+
+// diffTarget prints the diff between the live objects of a target and the config
+func diffTarget(t target) error {
+	client, err := k8s.New(k8s.Options{Connection: t.conn})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	color := useColor()
+	var created, updated, unchanged int
+	for _, obj := range t.objs {
+		live, err := client.Get(ctx, obj)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			live = nil
+		}
+		// token records argocd-server keeps on project roles are not drift
+		argocd.PreserveRoleTokens(obj.Obj, live)
+
+		liveMap, err := argocd.NormalizeForDiff(live)
+		if err != nil {
+			return err
+		}
+		desiredMap, err := argocd.NormalizeForDiff(obj.Obj)
+		if err != nil {
+			return err
+		}
+		argocd.RedactSecrets(liveMap, desiredMap)
+
+		var liveYAML []byte
+		if liveMap != nil {
+			if liveYAML, err = yaml.Marshal(liveMap); err != nil {
+				return err
+			}
+		}
+		desiredYAML, err := yaml.Marshal(desiredMap)
+		if err != nil {
+			return err
+		}
+
+		ref := fmt.Sprintf("%s/%s", obj.Obj.GetKind(), obj.Obj.GetName())
+		d := diff.Unified(string(liveYAML), string(desiredYAML), "live/"+ref, "desired/"+ref, 3, color)
+		switch {
+		case live == nil:
+			created++
+		case d == "":
+			unchanged++
+			continue
+		default:
+			updated++
+		}
+		fmt.Print(d)
+	}
+	fmt.Printf("%d to create, %d to update, %d unchanged\n", created, updated, unchanged)
+	return nil
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored diff output")
+}
+
+// useColor reports whether diff output should be colored
+func useColor() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
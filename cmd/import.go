@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"github.com/spf13/cobra"
+)
+
+var importFile string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Generate a config file from the Argo CD objects in the namespace",
+	Long: `Generate a config file from the Applications, AppProjects and repository
+secrets found in the namespace. Credentials are replaced with ${ENV}
+placeholders, and fields rgo cannot represent are reported on stderr.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := k8s.New(k8s.Options{Connection: connection()})
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		var cfg config.Config
+		var env []string
+		report := func(path, name string, warnings []string) {
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s (%s): %s\n", path, name, w)
+			}
+		}
+
+		projects, err := client.List(ctx, argocd.GVRAppProject, namespace, "")
+		if err != nil {
+			return fmt.Errorf("list appprojects: %w", err)
+		}
+		for _, o := range projects {
+			// every Argo CD install ships the default project
+			if o.Obj.GetName() == "default" {
+				continue
+			}
+			p, warn := argocd.ImportProject(o.Obj)
+			report(fmt.Sprintf("projects[%d]", len(cfg.Projects)), p.Name, warn)
+			cfg.Projects = append(cfg.Projects, p)
+		}
+
+		apps, err := client.List(ctx, argocd.GVRApplication, namespace, "")
+		if err != nil {
+			return fmt.Errorf("list applications: %w", err)
+		}
+		for _, o := range apps {
+			a, warn := argocd.ImportApplication(o.Obj)
+			report(fmt.Sprintf("applications[%d]", len(cfg.Applications)), a.Name, warn)
+			cfg.Applications = append(cfg.Applications, a)
+		}
+
+		secrets, err := client.List(ctx, argocd.GVRSecret, namespace, argocd.SecretTypeLabel)
+		if err != nil {
+			return fmt.Errorf("list secrets: %w", err)
+		}
+		for _, o := range secrets {
+			switch secretType := o.Obj.GetLabels()[argocd.SecretTypeLabel]; secretType {
+			case "repository":
+				r, vars, warn := argocd.ImportRepository(o.Obj)
+				report(fmt.Sprintf("repositories[%d]", len(cfg.Repositories)), o.Obj.GetName(), warn)
+				cfg.Repositories = append(cfg.Repositories, r)
+				env = append(env, vars...)
+			case "repo-creds":
+				c, vars, warn := argocd.ImportCredential(o.Obj)
+				report(fmt.Sprintf("credentials[%d]", len(cfg.Credentials)), o.Obj.GetName(), warn)
+				cfg.Credentials = append(cfg.Credentials, c)
+				env = append(env, vars...)
+			default:
+				fmt.Fprintf(os.Stderr, "warning: skipping secret %s of type %q\n", o.Obj.GetName(), secretType)
+			}
+		}
+
+		b, err := config.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		b = append([]byte(fmt.Sprintf("# Generated by rgo import from namespace %s\n", namespace)), b...)
+
+		if len(env) > 0 {
+			sort.Strings(env)
+			fmt.Fprintln(os.Stderr, "Set these environment variables before running apply:")
+			for _, e := range env {
+				fmt.Fprintln(os.Stderr, "  "+e)
+			}
+		}
+
+		if importFile == "" {
+			_, err = os.Stdout.Write(b)
+			return err
+		}
+		if err := os.WriteFile(importFile, b, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrote", importFile)
+		return nil
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "Write the config to this file instead of stdout")
+}
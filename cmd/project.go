@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiServer        string
+	apiInsecure      bool
+	tokenExpiresIn   time.Duration
+	tokenID          string
+	tokenDescription string
+	tokenSecret      string
+	tokenSecretKey   string
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage Argo CD projects through the Argo CD API server",
+}
+
+var projectTokenCmd = &cobra.Command{
+	Use:   "token <project> <role>",
+	Short: "Create a token for a project role",
+	Long: `Create a token for a project role through the Argo CD API server.
+
+The server and credentials come from the argocd section of the config, and
+ARGOCD_SERVER and ARGOCD_AUTH_TOKEN override them. The token is printed, or
+stored in a Kubernetes Secret with --secret.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, role := args[0], args[1]
+		if dryRun {
+			fmt.Printf("[dry-run] would create a token for role %s of project %s\n", role, project)
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		api, err := newAPIClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		token, err := api.CreateProjectToken(ctx, project, role, tokenID, tokenDescription, tokenExpiresIn)
+		if err != nil {
+			return err
+		}
+
+		if tokenSecret == "" {
+			fmt.Println(token)
+			return nil
+		}
+		client, err := k8s.New(k8s.Options{ServerSide: true, Retry: retryPolicy(cfg.APIRetry, os.Stderr), Connection: connection()})
+		if err != nil {
+			return err
+		}
+		if _, err := client.Apply(ctx, argocd.ProjectTokenSecret(tokenSecret, namespace, tokenSecretKey, project, role, token)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Stored token in secret %s/%s (key %s)\n", namespace, tokenSecret, tokenSecretKey)
+		return nil
+	},
+}
+
+var projectTokenListCmd = &cobra.Command{
+	Use:   "list <project> <role>",
+	Short: "List the tokens issued for a project role",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		api, err := newAPIClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		tokens, err := api.ProjectTokens(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("output") {
+			return k8s.PrintObject(tokens, output)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tISSUED AT\tEXPIRES AT")
+		for _, t := range tokens {
+			expires := "never"
+			if t.ExpiresAt > 0 {
+				expires = time.Unix(t.ExpiresAt, 0).UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", dash(t.ID), time.Unix(t.IssuedAt, 0).UTC().Format(time.RFC3339), expires)
+		}
+		return w.Flush()
+	},
+}
+
+var projectTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <project> <role> <id|issued-at>",
+	Short: "Revoke a project role token by id or issue time (unix seconds)",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, role, ref := args[0], args[1], args[2]
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		api, err := newAPIClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		tokens, err := api.ProjectTokens(ctx, project, role)
+		if err != nil {
+			return err
+		}
+		iat, _ := strconv.ParseInt(ref, 10, 64)
+		for _, t := range tokens {
+			if t.ID != ref && (iat == 0 || t.IssuedAt != iat) {
+				continue
+			}
+			if dryRun {
+				fmt.Printf("[dry-run] would revoke token %s of %s/%s\n", ref, project, role)
+				return nil
+			}
+			if err := api.DeleteProjectToken(ctx, project, role, t); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked token %s of %s/%s\n", ref, project, role)
+			return nil
+		}
+		return fmt.Errorf("no token %s for role %s of project %s", ref, role, project)
+	},
+}
+
+func init() {
+	projectCmd.PersistentFlags().StringVar(&apiServer, "server", "", "Argo CD API server URL (overrides argocd.server and ARGOCD_SERVER)")
+	projectCmd.PersistentFlags().BoolVar(&apiInsecure, "insecure", false, "Skip TLS verification of the Argo CD API server")
+
+	projectTokenCmd.Flags().DurationVar(&tokenExpiresIn, "expires-in", 0, "Token lifetime, e.g. 720h (default: never expires)")
+	projectTokenCmd.Flags().StringVar(&tokenID, "id", "", "Token id, used to revoke it later")
+	projectTokenCmd.Flags().StringVar(&tokenDescription, "description", "", "Token description")
+	projectTokenCmd.Flags().StringVar(&tokenSecret, "secret", "", "Store the token in this Secret in --namespace instead of printing it")
+	projectTokenCmd.Flags().StringVar(&tokenSecretKey, "secret-key", "token", "Key of the token in --secret")
+
+	projectTokenCmd.AddCommand(projectTokenListCmd)
+	projectTokenCmd.AddCommand(projectTokenRevokeCmd)
+	projectCmd.AddCommand(projectTokenCmd)
+}
+
+// newAPIClient connects to the Argo CD API server described by the config,
+// environment and flags, in increasing order of precedence
+func newAPIClient(ctx context.Context, cfg config.Config) (*argocd.APIClient, error) {
+	var s config.ArgoCDServer
+	if cfg.ArgoCD != nil {
+		s = *cfg.ArgoCD
+	}
+	if v := os.Getenv("ARGOCD_SERVER"); v != "" {
+		s.Server = v
+	}
+	if v := os.Getenv("ARGOCD_AUTH_TOKEN"); v != "" {
+		s.AuthToken = v
+		s.Username, s.Password = "", ""
+	}
+	if apiServer != "" {
+		s.Server = apiServer
+	}
+	if apiInsecure {
+		s.Insecure = true
+	}
+	return argocd.NewAPIClient(ctx, s)
+}
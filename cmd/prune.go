@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/k8s"
+)
+
+// pruneTimeout bounds listing the live objects, and separately deleting the
+// orphans once confirmed, so time spent at the prompt does not count
+const pruneTimeout = 90 * time.Second
+
+// pruneOrphans deletes rgo-managed objects in ns that are not in desired
+func pruneOrphans(client *k8s.Client, ns string, desired []k8s.Object, out io.Writer) error {
+	listCtx, cancel := context.WithTimeout(context.Background(), pruneTimeout)
+	live, err := listManaged(listCtx, client, ns)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	orphans := argocd.Orphans(live, desired)
+	if len(orphans) == 0 {
+		fmt.Fprintln(out, "Nothing to prune")
+		return nil
+	}
+
+	for _, o := range orphans {
+		if pruneDryRun {
+			fmt.Fprintf(out, "[prune-dry-run] would delete %s/%s in namespace %s\n", o.Obj.GetKind(), o.Obj.GetName(), o.NS)
+		} else {
+			fmt.Fprintf(out, "will delete %s/%s in namespace %s\n", o.Obj.GetKind(), o.Obj.GetName(), o.NS)
+		}
+	}
+	if pruneDryRun {
+		return nil
+	}
+	if !assumeYes && !confirm(fmt.Sprintf("Delete %d resources?", len(orphans))) {
+		fmt.Fprintln(out, "Prune aborted")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pruneTimeout)
+	defer cancel()
+	for _, o := range orphans {
+		if err := client.Delete(ctx, o); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted %s/%s\n", o.Obj.GetKind(), o.Obj.GetName())
+	}
+	return nil
+}
+
+// listManaged returns every rgo-managed object in ns
+func listManaged(ctx context.Context, client *k8s.Client, ns string) ([]k8s.Object, error) {
+	var live []k8s.Object
+	for _, gvr := range argocd.ManagedGVRs() {
+		objs, err := client.List(ctx, gvr, ns, argocd.ManagedSelector)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", gvr.Resource, err)
+		}
+		live = append(live, objs...)
+	}
+	return live, nil
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
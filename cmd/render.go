@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// renderHeader marks the files rgo owns in the output directory: only those
+// are overwritten or removed by later renders
+const renderHeader = "# Rendered by rgo; changes are overwritten by the next render\n"
+
+var (
+	renderDir      string
+	includeSecrets bool
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Write the Argo CD manifests built from the config to a directory",
+	Long: `Write every object built from the config to <out-dir>/<kind>/<name>.yaml
+together with a kustomization.yaml listing them, for committing to a
+bootstrap repository. With targets in the config each target is rendered to
+<out-dir>/<target>. Files left over from earlier renders are removed.
+
+Credential values in secrets are redacted, and secrets holding credentials
+are left out of kustomization.yaml so applying the directory cannot
+overwrite live credentials. Pass --include-secrets to write the values as
+they are.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if renderDir == "" {
+			return fmt.Errorf("--out-dir is required")
+		}
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		targets, err := resolveTargets(cfg)
+		if err != nil {
+			return err
+		}
+
+		written := map[string]bool{}
+		var roots []string
+		for _, t := range targets {
+			dir := filepath.Join(renderDir, t.name)
+			if err := renderTarget(t, dir, written); err != nil {
+				return err
+			}
+			roots = append(roots, dir)
+		}
+		// a full render owns the whole directory, so files of targets
+		// removed from the config go too; --target limits cleanup to its own
+		if len(targetNames) == 0 {
+			roots = []string{renderDir}
+		}
+		for _, root := range roots {
+			if err := removeStale(root, written); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// renderTarget writes the objects of one target and their kustomization.yaml
+// to dir, recording every path written
+func renderTarget(t target, dir string, written map[string]bool) error {
+	var resources []string
+	for _, o := range t.objs {
+		obj, redacted := o.Obj, false
+		if !includeSecrets {
+			var err error
+			if obj, redacted, err = argocd.RedactCredentials(o.Obj); err != nil {
+				return err
+			}
+		}
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		rel := filepath.Join(strings.ToLower(obj.GetKind()), obj.GetName()+".yaml")
+		perm := fs.FileMode(0o644)
+		if includeSecrets && obj.GetKind() == "Secret" {
+			perm = 0o600
+		}
+		if err := writeRendered(filepath.Join(dir, rel), b, perm, written); err != nil {
+			return err
+		}
+		if redacted {
+			fmt.Fprintf(os.Stderr, "warning: %s has redacted credentials and is not listed in kustomization.yaml\n", filepath.Join(dir, rel))
+			continue
+		}
+		resources = append(resources, filepath.ToSlash(rel))
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+	})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "kustomization.yaml")
+	if err := writeRendered(path, b, 0o644, written); err != nil {
+		return err
+	}
+	fmt.Printf("Rendered %d objects to %s\n", len(t.objs), dir)
+	return nil
+}
+
+// writeRendered writes a file with the render header, refusing to overwrite
+// files rgo did not render
+func writeRendered(path string, b []byte, perm fs.FileMode, written map[string]bool) error {
+	rendered, err := isRendered(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && !rendered {
+		return fmt.Errorf("%s exists and was not rendered by rgo", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append([]byte(renderHeader), b...), perm); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, perm); err != nil {
+		return err
+	}
+	written[filepath.Clean(path)] = true
+	return nil
+}
+
+// removeStale deletes rendered files under root that this render did not
+// write, and the directories that leaves empty
+func removeStale(root string, written map[string]bool) error {
+	var stale []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".yaml" || written[filepath.Clean(path)] {
+			return nil
+		}
+		rendered, err := isRendered(path)
+		if err != nil {
+			return err
+		}
+		if rendered {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Println("Removed", path)
+		// removing a non-empty directory fails, which stops the climb
+		for dir := filepath.Dir(path); dir != filepath.Clean(root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// isRendered reports whether the file at path starts with the render header
+func isRendered(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return false, nil
+	}
+	return line == renderHeader, nil
+}
+
+func init() {
+	renderCmd.Flags().StringVar(&renderDir, "out-dir", "", "Directory to write the manifests to")
+	renderCmd.Flags().BoolVar(&includeSecrets, "include-secrets", false, "Write secret credential values in plain text instead of redacting them")
+}
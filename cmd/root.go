@@ -2,7 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
@@ -13,7 +19,12 @@ var (
 	cfgFile   string
 	namespace string
 	dryRun    bool
-	output    string // yaml|json
+	output    string // yaml|json|table
+
+	retryAttempts   int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	retryJitter     float64
 )
 
 func Execute() {
@@ -38,10 +49,40 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to config file (YAML)")
 	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "argo-cd", "Argo CD namespace")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Preview resources instead of applying")
-	rootCmd.PersistentFlags().StringVar(&output, "output", "yaml", "Output format for dry-run: yaml|json")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "yaml", "Output format: yaml|json for dry-run, table|yaml|json for status")
+	rootCmd.PersistentFlags().StringSliceVar(&targetNames, "target", nil, "Limit apply, diff and status to these targets from the config")
+
+	// cluster connection; each flag can also be set as RGO_<FLAG>, e.g. RGO_PREFER_KUBECONFIG=true
+	flags := rootCmd.PersistentFlags()
+	flags.String("kubeconfig", "", "Path to the kubeconfig (default: in-cluster config, then $KUBECONFIG or ~/.kube/config)")
+	flags.String("context", "", "Kubeconfig context to use")
+	flags.Bool("prefer-kubeconfig", false, "Use the kubeconfig even when running inside a pod")
+	flags.String("as", "", "Username to impersonate")
+	flags.StringSlice("as-group", nil, "Group to impersonate, can be repeated")
+	flags.Duration("request-timeout", 0, "Timeout of a single Kubernetes API request, e.g. 30s (default: none)")
+	flags.Float32("qps", 0, "Maximum Kubernetes API queries per second (default: client-go default)")
+	flags.Int("burst", 0, "Maximum burst of Kubernetes API queries (default: client-go default)")
+	flags.IntVar(&retryAttempts, "retries", 5, "Attempts per Kubernetes API write, including the first; 1 disables retries")
+	flags.DurationVar(&retryBackoff, "retry-backoff", 500*time.Millisecond, "Delay before the first retry, doubled on each further retry")
+	flags.DurationVar(&retryMaxBackoff, "retry-max-backoff", 30*time.Second, "Longest delay between retries")
+	flags.Float64Var(&retryJitter, "retry-jitter", 0.2, "Random extra delay as a fraction of the delay, 0 to 1")
+
+	for _, name := range []string{"kubeconfig", "context", "prefer-kubeconfig", "as", "as-group", "request-timeout", "qps", "burst"} {
+		if err := viper.BindPFlag(name, flags.Lookup(name)); err != nil {
+			panic(err)
+		}
+	}
 
 	rootCmd.AddCommand(applyCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(clusterCmd)
+	rootCmd.AddCommand(projectCmd)
 }
 
 func initConfig() {
@@ -63,10 +104,60 @@ func initConfig() {
 
 	// 3. Env vars (including those loaded from .env)
 	viper.SetEnvPrefix("RGO")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
 
 	// 4. Merge config file if found
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config:", viper.ConfigFileUsed())
+		// stderr keeps stdout clean for generated output
+		fmt.Fprintln(os.Stderr, "Using config:", viper.ConfigFileUsed())
+	}
+}
+
+// connection reads the cluster connection flags, or their RGO_ environment
+// variables
+func connection() k8s.Connection {
+	return k8s.Connection{
+		Kubeconfig:        viper.GetString("kubeconfig"),
+		Context:           viper.GetString("context"),
+		PreferKubeconfig:  viper.GetBool("prefer-kubeconfig"),
+		Impersonate:       viper.GetString("as"),
+		ImpersonateGroups: viper.GetStringSlice("as-group"),
+		Timeout:           viper.GetDuration("request-timeout"),
+		QPS:               float32(viper.GetFloat64("qps")),
+		Burst:             viper.GetInt("burst"),
+	}
+}
+
+// retryPolicy combines the apiRetry config section, which may be nil, with
+// the --retry-* flags; flags given on the command line win. Each retry is
+// logged to out.
+func retryPolicy(cfg *config.APIRetry, out io.Writer) k8s.RetryPolicy {
+	p := k8s.RetryPolicy{
+		MaxAttempts: retryAttempts,
+		Backoff:     retryBackoff,
+		MaxBackoff:  retryMaxBackoff,
+		Jitter:      retryJitter,
+	}
+	if cfg != nil {
+		flags := rootCmd.PersistentFlags()
+		if cfg.MaxAttempts > 0 && !flags.Changed("retries") {
+			p.MaxAttempts = cfg.MaxAttempts
+		}
+		// durations were checked by Validate
+		if d, err := time.ParseDuration(cfg.Backoff); err == nil && !flags.Changed("retry-backoff") {
+			p.Backoff = d
+		}
+		if d, err := time.ParseDuration(cfg.MaxBackoff); err == nil && !flags.Changed("retry-max-backoff") {
+			p.MaxBackoff = d
+		}
+		if cfg.Jitter > 0 && !flags.Changed("retry-jitter") {
+			p.Jitter = cfg.Jitter
+		}
+	}
+	p.Log = func(o k8s.Object, attempt int, delay time.Duration, err error) {
+		fmt.Fprintf(out, "retrying %s/%s (attempt %d of %d) in %s: %v\n",
+			o.Obj.GetKind(), o.Obj.GetName(), attempt+1, p.MaxAttempts, delay.Round(time.Millisecond), err)
 	}
+	return p
 }
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zcubbs/rgo/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print the JSON Schema of the config file.
+
+Save it next to your config and reference it from the first line of the YAML
+file to get completion and inline errors in editors:
+
+  rgo schema > rgo.schema.json
+  # yaml-language-server: $schema=./rgo.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
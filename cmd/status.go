@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"github.com/spf13/cobra"
+)
+
+type statusReport struct {
+	Target          string                        `json:"target,omitempty"`
+	Applications    []argocd.AppStatus            `json:"applications"`
+	ApplicationSets []argocd.ApplicationSetStatus `json:"applicationSets"`
+	Projects        []argocd.ProjectStatus        `json:"projects"`
+	Secrets         []argocd.SecretStatus         `json:"secrets"`
+	// MissingFromCluster lists objects in the config that do not exist yet
+	MissingFromCluster []string `json:"missingFromCluster"`
+	// NotInConfig lists rgo-managed objects that the config no longer describes
+	NotInConfig []string `json:"notInConfig"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of rgo-managed applications, application sets, projects and repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadValidConfig()
+		if err != nil {
+			return err
+		}
+		targets, err := resolveTargets(cfg)
+		if err != nil {
+			return err
+		}
+		return eachTarget(targets, func(i int, t target) error {
+			report, err := targetStatus(t)
+			if err != nil {
+				return err
+			}
+			// table is the default here, unlike dry-run which defaults to yaml
+			if !cmd.Flags().Changed("output") || output == "table" {
+				if t.name != "" {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("=== target %s (namespace %s)\n", t.name, t.ns)
+				}
+				return printStatusTable(report)
+			}
+			return k8s.PrintObject(report, output)
+		})
+	},
+}
+
+// targetStatus compares the live rgo-managed objects of a target with the config
+func targetStatus(t target) (statusReport, error) {
+	client, err := k8s.New(k8s.Options{Connection: t.conn})
+	if err != nil {
+		return statusReport{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	live, err := listManaged(ctx, client, t.ns)
+	if err != nil {
+		return statusReport{}, err
+	}
+
+	report := statusReport{
+		Target:             t.name,
+		Applications:       []argocd.AppStatus{},
+		ApplicationSets:    []argocd.ApplicationSetStatus{},
+		Projects:           []argocd.ProjectStatus{},
+		Secrets:            []argocd.SecretStatus{},
+		MissingFromCluster: objectRefs(argocd.Difference(t.objs, live)),
+		NotInConfig:        objectRefs(argocd.Difference(live, t.objs)),
+	}
+	for _, o := range live {
+		switch o.Obj.GetKind() {
+		case "Application":
+			report.Applications = append(report.Applications, argocd.ApplicationStatus(o.Obj))
+		case "ApplicationSet":
+			report.ApplicationSets = append(report.ApplicationSets, argocd.ApplicationSetSummary(o.Obj))
+		case "AppProject":
+			report.Projects = append(report.Projects, argocd.ProjectSummary(o.Obj))
+		case "Secret":
+			report.Secrets = append(report.Secrets, argocd.SecretSummary(o.Obj))
+		}
+	}
+	return report, nil
+}
+
+func printStatusTable(r statusReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "APPLICATION\tPROJECT\tSYNC\tHEALTH\tREVISION\tOPERATION\tMESSAGE")
+	for _, a := range r.Applications {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.Name, a.Project, dash(a.Sync), dash(a.Health), dash(truncate(a.Revision, 8)), dash(a.Phase), truncate(a.Message, 60))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "APPLICATIONSET\tPROJECT\tGENERATORS\tAPPLICATIONS\tUP TO DATE\tMESSAGE")
+	for _, s := range r.ApplicationSets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			s.Name, dash(s.Project), dash(strings.Join(s.Generators, ",")), s.Applications, dash(s.UpToDate), truncate(s.Message, 60))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "PROJECT\tDESCRIPTION\tSOURCE REPOS")
+	for _, p := range r.Projects {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", p.Name, dash(p.Description), len(p.SourceRepos))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "SECRET\tKIND\tTYPE\tURL")
+	for _, s := range r.Secrets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, dash(s.SecretType), dash(s.Type), dash(s.URL))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.MissingFromCluster) > 0 {
+		fmt.Println("\nIn config but missing from cluster:")
+		for _, ref := range r.MissingFromCluster {
+			fmt.Println("  " + ref)
+		}
+	}
+	if len(r.NotInConfig) > 0 {
+		fmt.Println("\nIn cluster but not in config:")
+		for _, ref := range r.NotInConfig {
+			fmt.Println("  " + ref)
+		}
+	}
+	return nil
+}
+
+func objectRefs(objs []k8s.Object) []string {
+	out := make([]string, 0, len(objs))
+	for _, o := range objs {
+		out = append(out, o.Obj.GetKind()+"/"+o.Obj.GetName())
+	}
+	return out
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+)
+
+var targetNames []string
+
+// target is one Argo CD instance and the objects the config deploys to it
+type target struct {
+	name string // empty when the config declares no targets
+	ns   string
+	conn k8s.Connection
+	objs []k8s.Object
+}
+
+// resolveTargets splits the config into one target per Argo CD instance,
+// limited to --target when set. A config without targets yields a single
+// target using the connection flags.
+func resolveTargets(cfg config.Config) ([]target, error) {
+	if len(cfg.Targets) == 0 {
+		if len(targetNames) > 0 {
+			return nil, fmt.Errorf("--target is set but the config declares no targets")
+		}
+		return []target{{ns: namespace, conn: connection(), objs: buildObjects(cfg, namespace)}}, nil
+	}
+
+	for _, name := range targetNames {
+		if !slices.ContainsFunc(cfg.Targets, func(t config.Target) bool { return t.Name == name }) {
+			return nil, fmt.Errorf("unknown target %q", name)
+		}
+	}
+	var out []target
+	for _, t := range cfg.Targets {
+		if len(targetNames) > 0 && !slices.Contains(targetNames, t.Name) {
+			continue
+		}
+		conn := connection()
+		if t.Kubeconfig != "" {
+			conn.Kubeconfig = t.Kubeconfig
+		}
+		if t.Context != "" {
+			conn.Context = t.Context
+		}
+		ns := namespace
+		if t.Namespace != "" {
+			ns = t.Namespace
+		}
+		out = append(out, target{name: t.Name, ns: ns, conn: conn, objs: buildObjects(cfg.ForTarget(t.Name), ns)})
+	}
+	return out, nil
+}
+
+// eachTarget runs fn on the targets in turn. Targets are independent Argo CD
+// instances, so a failing one is reported and the others still run; the
+// error of a single target is returned as is.
+func eachTarget(targets []target, fn func(i int, t target) error) error {
+	failed := 0
+	for i, t := range targets {
+		err := fn(i, t)
+		if err == nil {
+			continue
+		}
+		if len(targets) == 1 {
+			return err
+		}
+		failed++
+		fmt.Fprintf(os.Stderr, "target %s failed: %v\n", t.name, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(targets))
+	}
+	return nil
+}
+
+// stdoutMu keeps lines written by concurrent targets whole
+var stdoutMu sync.Mutex
+
+// prefixWriter writes complete lines to stdout prefixed with the target name,
+// so output of targets running concurrently stays attributable
+type prefixWriter struct {
+	prefix string
+	mu     sync.Mutex // wait writes from one goroutine per application
+	buf    bytes.Buffer
+}
+
+// targetOutput returns where output about t goes: stdout itself for the
+// single unnamed target, a prefixing writer otherwise
+func targetOutput(t target) io.Writer {
+	if t.name == "" {
+		return os.Stdout
+	}
+	return &prefixWriter{prefix: "[" + t.name + "] "}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// keep the partial line for the next write
+			w.buf.Write(line)
+			return len(p), nil
+		}
+		stdoutMu.Lock()
+		_, err = fmt.Fprintf(os.Stdout, "%s%s", w.prefix, line)
+		stdoutMu.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
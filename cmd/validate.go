@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/zcubbs/rgo/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the config file without contacting the cluster",
+	Long: `Validate the config file without contacting the cluster.
+
+Config values come from the config file only. RGO_* environment variables set
+command line flags, such as RGO_KUBECONFIG for --kubeconfig, and do not
+override config keys. Refer to environment variables from config values with
+${VAR} placeholders instead; they are expanded when objects are built, so
+validate does not check that they are set.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := loadValidConfig(); err != nil {
+			return err
+		}
+		fmt.Println("Config is valid")
+		return nil
+	},
+}
+
+// loadValidConfig loads the config and runs every validation check on it
+func loadValidConfig() (config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
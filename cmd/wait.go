@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/argocd"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// waitForApplications blocks until every Application in objs, applied at
+// since, is synced and healthy, one of them fails, or ctx expires.
+// Applications without automated sync are not waited on: nothing syncs them.
+func waitForApplications(ctx context.Context, client *k8s.Client, objs []k8s.Object, since time.Time, out io.Writer) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+	)
+	for _, obj := range objs {
+		if obj.Obj.GetKind() != "Application" {
+			continue
+		}
+		if _, automated, _ := unstructured.NestedMap(obj.Obj.Object, "spec", "syncPolicy", "automated"); !automated {
+			fmt.Fprintf(out, "%s: manual sync, not waited on\n", obj.Obj.GetName())
+			continue
+		}
+		wg.Add(1)
+		go func(obj k8s.Object) {
+			defer wg.Done()
+			status, err := waitForApplication(ctx, client, obj, since, out)
+			if err == nil {
+				return
+			}
+			msg := fmt.Sprintf("%s: %v (%s)", obj.Obj.GetName(), err, status)
+			if status.Message != "" {
+				msg += ": " + status.Message
+			}
+			for _, r := range status.Resources {
+				msg += "\n    " + r
+			}
+			mu.Lock()
+			failures = append(failures, msg)
+			mu.Unlock()
+		}(obj)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d application(s) not ready:\n  %s", len(failures), strings.Join(failures, "\n  "))
+	}
+	fmt.Fprintln(out, "All applications synced and healthy")
+	return nil
+}
+
+// watchBackoff bounds the delay between reconnects of a watch that keeps
+// closing without delivering events
+const (
+	watchBackoff    = time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+func waitForApplication(ctx context.Context, client *k8s.Client, obj k8s.Object, since time.Time, out io.Writer) (argocd.AppStatus, error) {
+	name := obj.Obj.GetName()
+	var last argocd.AppStatus
+	delay := watchBackoff
+	for {
+		w, err := client.Watch(ctx, obj)
+		if err != nil && !watchRetryable(err) {
+			if ctx.Err() != nil {
+				return last, errors.New("timed out")
+			}
+			return last, err
+		}
+		received := false
+		if err == nil {
+			for ev := range w.ResultChan() {
+				if ev.Type == watch.Error {
+					// an expired resourceVersion or a restarting server
+					// ends the watch; anything else will not go away
+					if err := apierrors.FromObject(ev.Object); !watchRetryable(err) {
+						w.Stop()
+						return last, err
+					}
+					break
+				}
+				if ev.Type != watch.Added && ev.Type != watch.Modified {
+					continue
+				}
+				u, ok := ev.Object.(*unstructured.Unstructured)
+				if !ok {
+					continue
+				}
+				received = true
+				status := argocd.ApplicationStatus(u)
+				if status.String() != last.String() {
+					fmt.Fprintf(out, "%s: %s\n", name, status)
+				}
+				last = status
+				// a status from before the apply says nothing about the new spec
+				if !argocd.StatusCurrent(u, since) {
+					continue
+				}
+				if status.Ready() {
+					w.Stop()
+					return status, nil
+				}
+				if status.Failed() {
+					w.Stop()
+					return status, errors.New("failed")
+				}
+			}
+			w.Stop()
+		}
+
+		// the server closes watches periodically; reconnect until ctx
+		// expires, backing off while the watch keeps failing at once
+		if received {
+			delay = watchBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return last, errors.New("timed out")
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, watchMaxBackoff)
+	}
+}
+
+// watchRetryable reports whether a failed watch is worth starting again
+func watchRetryable(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) || utilnet.IsConnectionRefused(err) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
@@ -0,0 +1,187 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zcubbs/rgo/pkg/config"
+)
+
+// fakeArgoCD is a stand-in for the Argo CD API server. It accepts the session
+// token it hands out and records the requests it serves.
+type fakeArgoCD struct {
+	requests []string
+	bodies   []map[string]interface{}
+}
+
+func (f *fakeArgoCD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+	var body map[string]interface{}
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+	f.bodies = append(f.bodies, body)
+
+	if r.URL.Path == "/api/v1/session" {
+		if body["username"] != "admin" || body["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid username or password","code":16,"message":"invalid username or password"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"session-token"}`))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer session-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"no session information"}`))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/projects/demo/roles/ci/token":
+		_, _ = w.Write([]byte(`{"token":"jwt"}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/projects/demo":
+		_, _ = w.Write([]byte(`{
+			"spec": {"roles": [{"name": "ci", "jwtTokens": [{"iat": 1}]}, {"name": "ops"}]},
+			"status": {"jwtTokensByRole": {"ci": {"items": [{"iat": 1700000000, "exp": 1800000000, "id": "build"}]}}}
+		}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/projects/legacy":
+		_, _ = w.Write([]byte(`{"spec": {"roles": [{"name": "ci", "jwtTokens": [{"iat": 1600000000}]}]}}`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/projects/demo/roles/ci/token/"):
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+func newTestAPIClient(t *testing.T) (*APIClient, *fakeArgoCD) {
+	t.Helper()
+	fake := &fakeArgoCD{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	c, err := NewAPIClient(context.Background(), config.ArgoCDServer{Server: srv.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewAPIClient: %v", err)
+	}
+	return c, fake
+}
+
+func TestNewAPIClientLogin(t *testing.T) {
+	c, fake := newTestAPIClient(t)
+	if c.token != "session-token" {
+		t.Errorf("token = %q, want the session token", c.token)
+	}
+	if len(fake.requests) != 1 || fake.requests[0] != "POST /api/v1/session" {
+		t.Errorf("requests = %v, want a single session login", fake.requests)
+	}
+}
+
+func TestNewAPIClientLoginFailure(t *testing.T) {
+	srv := httptest.NewServer(&fakeArgoCD{})
+	defer srv.Close()
+	_, err := NewAPIClient(context.Background(), config.ArgoCDServer{Server: srv.URL, Username: "admin", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid username or password") {
+		t.Fatalf("err = %v, want a 401 with the server message", err)
+	}
+}
+
+func TestNewAPIClientToken(t *testing.T) {
+	t.Setenv("TEST_ARGOCD_TOKEN", "session-token")
+	fake := &fakeArgoCD{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c, err := NewAPIClient(context.Background(), config.ArgoCDServer{Server: srv.URL, AuthToken: "${TEST_ARGOCD_TOKEN}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("requests = %v, want no login with a token", fake.requests)
+	}
+	if _, err := c.ProjectTokens(context.Background(), "demo", "ci"); err != nil {
+		t.Errorf("ProjectTokens: %v", err)
+	}
+}
+
+func TestCreateProjectToken(t *testing.T) {
+	c, fake := newTestAPIClient(t)
+	token, err := c.CreateProjectToken(context.Background(), "demo", "ci", "build", "CI pipeline", 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "jwt" {
+		t.Errorf("token = %q, want jwt", token)
+	}
+	body := fake.bodies[len(fake.bodies)-1]
+	if body["id"] != "build" || body["description"] != "CI pipeline" || body["expiresIn"] != float64(86400) {
+		t.Errorf("request body = %v", body)
+	}
+}
+
+func TestCreateProjectTokenError(t *testing.T) {
+	c, _ := newTestAPIClient(t)
+	_, err := c.CreateProjectToken(context.Background(), "demo", "missing", "", "", 0)
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("err = %v, want a 404 with the server message", err)
+	}
+}
+
+func TestProjectTokens(t *testing.T) {
+	c, _ := newTestAPIClient(t)
+
+	tokens, err := c.ProjectTokens(context.Background(), "demo", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProjectToken{IssuedAt: 1700000000, ExpiresAt: 1800000000, ID: "build"}
+	if len(tokens) != 1 || tokens[0] != want {
+		t.Errorf("tokens = %+v, want the status entry %+v", tokens, want)
+	}
+
+	tokens, err = c.ProjectTokens(context.Background(), "legacy", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].IssuedAt != 1600000000 {
+		t.Errorf("tokens = %+v, want the spec entry", tokens)
+	}
+
+	tokens, err = c.ProjectTokens(context.Background(), "demo", "ops")
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("tokens, err = %+v, %v; want none", tokens, err)
+	}
+
+	if _, err := c.ProjectTokens(context.Background(), "demo", "nope"); err == nil {
+		t.Error("want an error for an unknown role")
+	}
+	if _, err := c.ProjectTokens(context.Background(), "missing", "ci"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want a 404", err)
+	}
+}
+
+func TestDeleteProjectToken(t *testing.T) {
+	c, fake := newTestAPIClient(t)
+
+	if err := c.DeleteProjectToken(context.Background(), "demo", "ci", ProjectToken{IssuedAt: 1700000000, ID: "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.requests[len(fake.requests)-1], "DELETE /api/v1/projects/demo/roles/ci/token/1700000000?id=build"; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+
+	if err := c.DeleteProjectToken(context.Background(), "demo", "ci", ProjectToken{IssuedAt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.requests[len(fake.requests)-1], "DELETE /api/v1/projects/demo/roles/ci/token/1"; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+
+	if err := c.DeleteProjectToken(context.Background(), "other", "ci", ProjectToken{IssuedAt: 1}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want a 404", err)
+	}
+}
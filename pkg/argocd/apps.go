@@ -1,7 +1,7 @@
 package argocd
 
 import (
-	"time"
+	"strings"
 
 	"github.com/zcubbs/rgo/pkg/config"
 	"github.com/zcubbs/rgo/pkg/k8s"
@@ -10,14 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-var gvrApplication = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
-
-func getTimestamp() string {
-	// Format timestamp in a way that is compatible with Kubernetes label requirements
-	// Replace colons and plus signs with dashes, remove any other invalid characters
-	timestamp := time.Now().Format("2006-01-02T15-04-05")
-	return timestamp
-}
+var GVRApplication = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
 
 func BuildApplications(apps []config.Application, ns string) []k8s.Object {
 	out := make([]k8s.Object, 0, len(apps))
@@ -28,126 +21,365 @@ func BuildApplications(apps []config.Application, ns string) []k8s.Object {
 			targetRevision = "HEAD"
 		}
 
-		// Handle OCI Helm charts differently
-		if a.IsOCI && a.IsHelm {
-			obj := &unstructured.Unstructured{Object: map[string]interface{}{
-				"apiVersion": "argoproj.io/v1alpha1",
-				"kind":       "Application",
-				"metadata": map[string]interface{}{
-					"name":      a.Name,
-					"namespace": ns,
-					"labels": map[string]interface{}{
-						"managed-by": "rgo",
-						"created-at": getTimestamp(),
-					},
+		spec := map[string]interface{}{
+			"project": a.Project,
+			"destination": map[string]interface{}{
+				"server":    a.DestinationServer,
+				"namespace": a.DestinationNamespace,
+			},
+		}
+
+		if len(a.Sources) > 0 {
+			// Explicit multi-source application
+			sources := make([]interface{}, 0, len(a.Sources))
+			for _, src := range a.Sources {
+				sources = append(sources, buildSource(src))
+			}
+			spec["sources"] = sources
+		} else if a.IsOCI && a.HelmSource() {
+			// Handle OCI Helm charts differently
+			spec["sources"] = []map[string]interface{}{
+				{
+					"repoURL":        a.OCIRepoURL,
+					"targetRevision": a.OCIChartVersion,
+					"chart":          a.OCIChartName,
+					"helm":           buildHelm(a.HelmValueFiles, a.Helm, true),
 				},
-				"spec": map[string]interface{}{
-					"project": a.Project,
-					"sources": []map[string]interface{}{
-						{
-							"repoURL":        a.OCIRepoURL,
-							"targetRevision": a.OCIChartVersion,
-							"chart":          a.OCIChartName,
-							"helm": map[string]interface{}{
-								"passCredentials": true,
-								"valueFiles":      a.HelmValueFiles,
-								"enableOCI":       true,
-							},
-						},
-						{
-							"repoURL":        a.SourceRepoURL,
-							"targetRevision": targetRevision,
-							"path":           a.SourcePath,
-							"ref":            "values",
-						},
-					},
-					"destination": map[string]interface{}{
-						"server":    a.DestinationServer,
-						"namespace": a.DestinationNamespace,
-					},
-					"syncPolicy": map[string]interface{}{
-						"automated": map[string]interface{}{
-							"prune":      true,
-							"selfHeal":   true,
-							"allowEmpty": false,
-						},
-					},
+				{
+					"repoURL":        firstNonEmpty(a.ValuesRepoURL, a.SourceRepoURL),
+					"targetRevision": firstNonEmpty(a.ValuesTargetRevision, targetRevision),
+					"path":           firstNonEmpty(a.ValuesPath, a.SourcePath),
+					"ref":            "values",
 				},
-			}}
-			out = append(out, k8s.Object{Obj: obj, GVR: gvrApplication, NS: ns})
-		} else if a.IsHelm {
+			}
+		} else if a.HelmSource() {
 			// Regular Helm chart
-			obj := &unstructured.Unstructured{Object: map[string]interface{}{
-				"apiVersion": "argoproj.io/v1alpha1",
-				"kind":       "Application",
-				"metadata": map[string]interface{}{
-					"name":      a.Name,
-					"namespace": ns,
-					"labels": map[string]interface{}{
-						"managed-by": "rgo",
-						"created-at": getTimestamp(),
-					},
-				},
-				"spec": map[string]interface{}{
-					"project": a.Project,
-					"source": map[string]interface{}{
-						"repoURL":        a.SourceRepoURL,
-						"targetRevision": targetRevision,
-						"path":           a.SourcePath,
-						"helm": map[string]interface{}{
-							"passCredentials": true,
-							"valueFiles":      a.HelmValueFiles,
-						},
-					},
-					"destination": map[string]interface{}{
-						"server":    a.DestinationServer,
-						"namespace": a.DestinationNamespace,
-					},
-					"syncPolicy": map[string]interface{}{
-						"automated": map[string]interface{}{
-							"prune":      true,
-							"selfHeal":   true,
-							"allowEmpty": false,
-						},
-					},
-				},
-			}}
-			out = append(out, k8s.Object{Obj: obj, GVR: gvrApplication, NS: ns})
+			spec["source"] = map[string]interface{}{
+				"repoURL":        a.SourceRepoURL,
+				"targetRevision": targetRevision,
+				"path":           a.SourcePath,
+				"helm":           buildHelm(a.HelmValueFiles, a.Helm, false),
+			}
 		} else {
 			// Regular Git application
-			obj := &unstructured.Unstructured{Object: map[string]interface{}{
-				"apiVersion": "argoproj.io/v1alpha1",
-				"kind":       "Application",
-				"metadata": map[string]interface{}{
-					"name":      a.Name,
-					"namespace": ns,
-					"labels": map[string]interface{}{
-						"managed-by": "rgo",
-						"created-at": getTimestamp(),
-					},
-				},
-				"spec": map[string]interface{}{
-					"project": a.Project,
-					"source": map[string]interface{}{
-						"repoURL":        a.SourceRepoURL,
-						"targetRevision": targetRevision,
-						"path":           a.SourcePath,
-					},
-					"destination": map[string]interface{}{
-						"server":    a.DestinationServer,
-						"namespace": a.DestinationNamespace,
-					},
-					"syncPolicy": map[string]interface{}{
-						"automated": map[string]interface{}{
-							"prune":      true,
-							"selfHeal":   true,
-							"allowEmpty": false,
-						},
-					},
+			source := map[string]interface{}{
+				"repoURL":        a.SourceRepoURL,
+				"targetRevision": targetRevision,
+				"path":           a.SourcePath,
+			}
+			if a.Kustomize != nil {
+				source["kustomize"] = buildKustomize(*a.Kustomize)
+			}
+			if a.Directory != nil {
+				source["directory"] = buildDirectory(*a.Directory)
+			}
+			if a.Plugin != nil {
+				source["plugin"] = buildPlugin(*a.Plugin)
+			}
+			spec["source"] = source
+		}
+
+		if syncPolicy := buildSyncPolicy(a.SyncPolicy); syncPolicy != nil {
+			spec["syncPolicy"] = syncPolicy
+		}
+
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Application",
+			"metadata": map[string]interface{}{
+				"name":      a.Name,
+				"namespace": ns,
+				"labels": map[string]interface{}{
+					"managed-by": "rgo",
 				},
-			}}
-			out = append(out, k8s.Object{Obj: obj, GVR: gvrApplication, NS: ns})
+			},
+			"spec": spec,
+		}}
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRApplication, NS: ns})
+	}
+	return out
+}
+
+// buildSource maps one entry of a multi-source application
+func buildSource(src config.Source) map[string]interface{} {
+	out := map[string]interface{}{"repoURL": src.RepoURL}
+	setString(out, "path", src.Path)
+	setString(out, "ref", src.Ref)
+
+	switch src.SourceType() {
+	case config.SourceTypeHelm, config.SourceTypeOCI:
+		setString(out, "chart", src.Chart)
+		out["targetRevision"] = src.TargetRevision
+		out["helm"] = buildHelm(src.HelmValueFiles, src.Helm, src.SourceType() == config.SourceTypeOCI)
+	case config.SourceTypeKustomize:
+		out["targetRevision"] = firstNonEmpty(src.TargetRevision, "HEAD")
+		k := config.Kustomize{}
+		if src.Kustomize != nil {
+			k = *src.Kustomize
+		}
+		out["kustomize"] = buildKustomize(k)
+	default:
+		out["targetRevision"] = firstNonEmpty(src.TargetRevision, "HEAD")
+		if src.Directory != nil {
+			out["directory"] = buildDirectory(*src.Directory)
+		}
+		if src.Plugin != nil {
+			out["plugin"] = buildPlugin(*src.Plugin)
+		}
+	}
+	return out
+}
+
+// buildDirectory maps directory and jsonnet options onto source.directory
+func buildDirectory(d config.Directory) map[string]interface{} {
+	out := map[string]interface{}{}
+	if d.Recurse {
+		out["recurse"] = true
+	}
+	setString(out, "include", d.Include)
+	setString(out, "exclude", d.Exclude)
+	if j := d.Jsonnet; j != nil {
+		jsonnet := map[string]interface{}{}
+		if len(j.TLAs) > 0 {
+			jsonnet["tlas"] = jsonnetVars(j.TLAs)
+		}
+		if len(j.ExtVars) > 0 {
+			jsonnet["extVars"] = jsonnetVars(j.ExtVars)
+		}
+		if len(j.Libs) > 0 {
+			jsonnet["libs"] = toInterfaces(j.Libs)
+		}
+		out["jsonnet"] = jsonnet
+	}
+	return out
+}
+
+func jsonnetVars(vars []config.JsonnetVar) []interface{} {
+	out := make([]interface{}, 0, len(vars))
+	for _, v := range vars {
+		m := map[string]interface{}{"name": v.Name, "value": v.Value}
+		if v.Code {
+			m["code"] = true
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// buildPlugin maps Config Management Plugin options onto source.plugin
+func buildPlugin(p config.Plugin) map[string]interface{} {
+	out := map[string]interface{}{}
+	setString(out, "name", p.Name)
+	if len(p.Env) > 0 {
+		env := make([]interface{}, 0, len(p.Env))
+		for _, e := range p.Env {
+			env = append(env, map[string]interface{}{"name": e.Name, "value": e.Value})
+		}
+		out["env"] = env
+	}
+	if len(p.Parameters) > 0 {
+		params := make([]interface{}, 0, len(p.Parameters))
+		for _, param := range p.Parameters {
+			m := map[string]interface{}{"name": param.Name}
+			switch {
+			case len(param.Array) > 0:
+				m["array"] = toInterfaces(param.Array)
+			case len(param.Map) > 0:
+				m["map"] = stringMap(param.Map)
+			default:
+				m["string"] = param.String
+			}
+			params = append(params, m)
+		}
+		out["parameters"] = params
+	}
+	return out
+}
+
+// buildHelm maps helm options onto source.helm. valueFiles are the legacy
+// helmValueFiles, placed before the ones of the helm block.
+func buildHelm(valueFiles []string, h *config.Helm, oci bool) map[string]interface{} {
+	if h == nil {
+		h = &config.Helm{}
+	}
+	out := map[string]interface{}{"passCredentials": boolOr(h.PassCredentials, true)}
+	if oci {
+		out["enableOCI"] = true
+	}
+	if files := append(append([]string{}, valueFiles...), h.ValueFiles...); len(files) > 0 {
+		out["valueFiles"] = toInterfaces(files)
+	}
+	setString(out, "values", h.Values)
+	if len(h.ValuesObject) > 0 {
+		out["valuesObject"] = h.ValuesObject
+	}
+	setString(out, "releaseName", h.ReleaseName)
+	setString(out, "version", h.Version)
+	if h.SkipCrds {
+		out["skipCrds"] = true
+	}
+	if h.IgnoreMissingValueFiles {
+		out["ignoreMissingValueFiles"] = true
+	}
+	if len(h.Parameters) > 0 {
+		params := make([]interface{}, 0, len(h.Parameters))
+		for _, p := range h.Parameters {
+			param := map[string]interface{}{"name": p.Name, "value": p.Value}
+			if p.ForceString {
+				param["forceString"] = true
+			}
+			params = append(params, param)
+		}
+		out["parameters"] = params
+	}
+	if len(h.FileParameters) > 0 {
+		params := make([]interface{}, 0, len(h.FileParameters))
+		for _, p := range h.FileParameters {
+			params = append(params, map[string]interface{}{"name": p.Name, "path": p.Path})
+		}
+		out["fileParameters"] = params
+	}
+	return out
+}
+
+// buildKustomize maps kustomize options onto source.kustomize
+func buildKustomize(k config.Kustomize) map[string]interface{} {
+	out := map[string]interface{}{}
+	setString(out, "namePrefix", k.NamePrefix)
+	setString(out, "nameSuffix", k.NameSuffix)
+	setString(out, "namespace", k.Namespace)
+	setString(out, "version", k.Version)
+	if len(k.Images) > 0 {
+		out["images"] = toInterfaces(k.Images)
+	}
+	if len(k.CommonLabels) > 0 {
+		out["commonLabels"] = stringMap(k.CommonLabels)
+	}
+	if len(k.CommonAnnotations) > 0 {
+		out["commonAnnotations"] = stringMap(k.CommonAnnotations)
+	}
+	if len(k.Replicas) > 0 {
+		replicas := make([]interface{}, 0, len(k.Replicas))
+		for _, r := range k.Replicas {
+			replicas = append(replicas, map[string]interface{}{"name": r.Name, "count": r.Count})
+		}
+		out["replicas"] = replicas
+	}
+	if len(k.Patches) > 0 {
+		patches := make([]interface{}, 0, len(k.Patches))
+		for _, p := range k.Patches {
+			patch := map[string]interface{}{}
+			setString(patch, "patch", p.Patch)
+			setString(patch, "path", p.Path)
+			if t := p.Target; t != nil {
+				target := map[string]interface{}{}
+				setString(target, "group", t.Group)
+				setString(target, "version", t.Version)
+				setString(target, "kind", t.Kind)
+				setString(target, "name", t.Name)
+				setString(target, "namespace", t.Namespace)
+				setString(target, "labelSelector", t.LabelSelector)
+				setString(target, "annotationSelector", t.AnnotationSelector)
+				patch["target"] = target
+			}
+			if len(p.Options) > 0 {
+				opts := make(map[string]interface{}, len(p.Options))
+				for k, v := range p.Options {
+					opts[k] = v
+				}
+				patch["options"] = opts
+			}
+			patches = append(patches, patch)
+		}
+		out["patches"] = patches
+	}
+	return out
+}
+
+// buildSyncPolicy maps the config sync policy onto spec.syncPolicy.
+// It returns nil for a manual policy without options or retry.
+func buildSyncPolicy(p config.SyncPolicy) map[string]interface{} {
+	out := map[string]interface{}{}
+	if p.Automated() {
+		// prune and selfHeal default to true, as rgo has always done
+		out["automated"] = map[string]interface{}{
+			"prune":      boolOr(p.Prune, true),
+			"selfHeal":   boolOr(p.SelfHeal, true),
+			"allowEmpty": p.AllowEmpty,
+		}
+	}
+
+	if len(p.SyncOptions) > 0 {
+		opts := make([]interface{}, 0, len(p.SyncOptions))
+		for _, o := range p.SyncOptions {
+			// Accept bare option names such as "CreateNamespace"
+			if !strings.Contains(o, "=") {
+				o += "=true"
+			}
+			opts = append(opts, o)
 		}
+		out["syncOptions"] = opts
+	}
+
+	if p.Retry != nil {
+		retry := map[string]interface{}{"limit": p.Retry.Limit}
+		if b := p.Retry.Backoff; b != nil {
+			backoff := map[string]interface{}{}
+			if b.Duration != "" {
+				backoff["duration"] = b.Duration
+			}
+			if b.Factor != 0 {
+				backoff["factor"] = b.Factor
+			}
+			if b.MaxDuration != "" {
+				backoff["maxDuration"] = b.MaxDuration
+			}
+			retry["backoff"] = backoff
+		}
+		out["retry"] = retry
+	}
+
+	if len(out) == 0 {
+		return nil
 	}
 	return out
 }
+
+func boolOr(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+// setString sets m[key] only for non-empty values, keeping manifests minimal
+func setString(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+func toInterfaces(list []string) []interface{} {
+	out := make([]interface{}, 0, len(list))
+	for _, s := range list {
+		out = append(out, s)
+	}
+	return out
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package argocd
+
+import (
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var GVRApplicationSet = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applicationsets"}
+
+func BuildApplicationSets(sets []config.ApplicationSet, ns string) []k8s.Object {
+	out := make([]k8s.Object, 0, len(sets))
+	for _, s := range sets {
+		// The template spec is exactly what a standalone application would get
+		app := BuildApplications([]config.Application{s.Template}, ns)[0].Obj
+
+		spec := map[string]interface{}{
+			"generators": buildGenerators(s.Generators),
+			"template": map[string]interface{}{
+				// no managed-by label: generated applications belong to the set, not to rgo
+				"metadata": map[string]interface{}{"name": s.Template.Name},
+				"spec":     app.Object["spec"],
+			},
+		}
+		if s.GoTemplate {
+			spec["goTemplate"] = true
+			if len(s.GoTemplateOptions) > 0 {
+				spec["goTemplateOptions"] = toInterfaces(s.GoTemplateOptions)
+			}
+		}
+		if p := s.SyncPolicy; p != nil {
+			syncPolicy := map[string]interface{}{}
+			if p.PreserveResourcesOnDeletion {
+				syncPolicy["preserveResourcesOnDeletion"] = true
+			}
+			setString(syncPolicy, "applicationsSync", p.ApplicationsSync)
+			spec["syncPolicy"] = syncPolicy
+		}
+
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "ApplicationSet",
+			"metadata": map[string]interface{}{
+				"name":      s.Name,
+				"namespace": ns,
+				"labels": map[string]interface{}{
+					"managed-by": "rgo",
+				},
+			},
+			"spec": spec,
+		}}
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRApplicationSet, NS: ns})
+	}
+	return out
+}
+
+func buildGenerators(generators []config.Generator) []interface{} {
+	out := make([]interface{}, 0, len(generators))
+	for _, g := range generators {
+		switch {
+		case g.List != nil:
+			elements := make([]interface{}, 0, len(g.List.Elements))
+			for _, e := range g.List.Elements {
+				elements = append(elements, e)
+			}
+			out = append(out, map[string]interface{}{"list": map[string]interface{}{"elements": elements}})
+		case g.Clusters != nil:
+			clusters := map[string]interface{}{}
+			if len(g.Clusters.Selector) > 0 {
+				clusters["selector"] = map[string]interface{}{"matchLabels": stringMap(g.Clusters.Selector)}
+			}
+			if len(g.Clusters.Values) > 0 {
+				clusters["values"] = stringMap(g.Clusters.Values)
+			}
+			out = append(out, map[string]interface{}{"clusters": clusters})
+		case g.Git != nil:
+			git := map[string]interface{}{
+				"repoURL":  g.Git.RepoURL,
+				"revision": firstNonEmpty(g.Git.Revision, "HEAD"),
+			}
+			if len(g.Git.Directories) > 0 {
+				dirs := make([]interface{}, 0, len(g.Git.Directories))
+				for _, d := range g.Git.Directories {
+					dir := map[string]interface{}{"path": d.Path}
+					if d.Exclude {
+						dir["exclude"] = true
+					}
+					dirs = append(dirs, dir)
+				}
+				git["directories"] = dirs
+			}
+			if len(g.Git.Files) > 0 {
+				files := make([]interface{}, 0, len(g.Git.Files))
+				for _, f := range g.Git.Files {
+					files = append(files, map[string]interface{}{"path": f.Path})
+				}
+				git["files"] = files
+			}
+			out = append(out, map[string]interface{}{"git": git})
+		case g.Matrix != nil:
+			out = append(out, map[string]interface{}{"matrix": map[string]interface{}{
+				"generators": buildGenerators(g.Matrix.Generators),
+			}})
+		}
+	}
+	return out
+}
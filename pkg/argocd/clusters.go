@@ -0,0 +1,276 @@
+package argocd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// BuildClusterSecrets builds the declarative cluster secrets Argo CD reads
+// destination clusters from.
+func BuildClusterSecrets(clusters []config.Cluster, ns string) []k8s.Object {
+	out := make([]k8s.Object, 0, len(clusters))
+	for _, c := range clusters {
+		// only strings, bools and string slices: marshalling cannot fail
+		clusterConfig, _ := json.Marshal(buildClusterConfig(c.Config))
+		stringData := map[string]interface{}{
+			"name":   c.Name,
+			"server": resolveEnvVar(c.Server),
+			"config": string(clusterConfig),
+		}
+		if len(c.Namespaces) > 0 {
+			stringData["namespaces"] = strings.Join(c.Namespaces, ",")
+			if c.ClusterResources {
+				stringData["clusterResources"] = "true"
+			}
+		}
+		setString(stringData, "project", c.Project)
+
+		// user labels are what the ApplicationSet clusters generator selects on
+		labels := stringMap(c.Labels)
+		labels[SecretTypeLabel] = "cluster"
+		labels["managed-by"] = "rgo"
+		metadata := map[string]interface{}{
+			"name":      "cluster-" + c.Name,
+			"namespace": ns,
+			"labels":    labels,
+		}
+		if len(c.Annotations) > 0 {
+			metadata["annotations"] = stringMap(c.Annotations)
+		}
+
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   metadata,
+			"stringData": stringData,
+		}}
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRSecret, NS: ns})
+	}
+	return out
+}
+
+// buildClusterConfig renders the config key of a cluster secret, resolving
+// ${ENV} placeholders in every credential
+func buildClusterConfig(c config.ClusterConfig) map[string]interface{} {
+	out := map[string]interface{}{}
+	setString(out, "bearerToken", resolveEnvVar(c.BearerToken))
+	setString(out, "username", resolveEnvVar(c.Username))
+	setString(out, "password", resolveEnvVar(c.Password))
+
+	tls := map[string]interface{}{}
+	if t := c.TLSClientConfig; t != nil {
+		if t.Insecure {
+			tls["insecure"] = true
+		}
+		setString(tls, "serverName", t.ServerName)
+		setString(tls, "caData", resolveEnvVar(t.CAData))
+		setString(tls, "certData", resolveEnvVar(t.CertData))
+		setString(tls, "keyData", resolveEnvVar(t.KeyData))
+	}
+	// Argo CD rejects a config without tlsClientConfig
+	out["tlsClientConfig"] = tls
+
+	if e := c.ExecProviderConfig; e != nil {
+		exec := map[string]interface{}{"command": e.Command}
+		if len(e.Args) > 0 {
+			exec["args"] = toInterfaces(e.Args)
+		}
+		if len(e.Env) > 0 {
+			env := map[string]interface{}{}
+			for k, v := range e.Env {
+				env[k] = resolveEnvVar(v)
+			}
+			exec["env"] = env
+		}
+		setString(exec, "apiVersion", firstNonEmpty(e.APIVersion, "client.authentication.k8s.io/v1beta1"))
+		setString(exec, "installHint", e.InstallHint)
+		out["execProviderConfig"] = exec
+	}
+	if a := c.AWSAuthConfig; a != nil {
+		aws := map[string]interface{}{"clusterName": a.ClusterName}
+		setString(aws, "roleARN", resolveEnvVar(a.RoleARN))
+		setString(aws, "profile", a.Profile)
+		out["awsAuthConfig"] = aws
+	}
+	if c.GCPAuth {
+		// argocd-k8s-auth ships in the Argo CD image and uses the pod's workload identity
+		out["execProviderConfig"] = map[string]interface{}{
+			"command":    "argocd-k8s-auth",
+			"args":       []interface{}{"gcp"},
+			"apiVersion": "client.authentication.k8s.io/v1beta1",
+		}
+	}
+	return out
+}
+
+var (
+	GVRServiceAccount     = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "serviceaccounts"}
+	GVRClusterRoleBinding = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}
+)
+
+// ClusterFromRESTConfig converts the connection details of a kubeconfig
+// context into a cluster entry. Files referenced by the kubeconfig are inlined.
+func ClusterFromRESTConfig(name string, cfg *rest.Config) (config.Cluster, error) {
+	c := config.Cluster{Name: name, Server: cfg.Host}
+	if cfg.AuthProvider != nil {
+		return c, fmt.Errorf("auth provider %q is not supported by Argo CD, use an exec plugin or --service-account", cfg.AuthProvider.Name)
+	}
+
+	readFile := func(data []byte, file string) ([]byte, error) {
+		if len(data) > 0 || file == "" {
+			return data, nil
+		}
+		return os.ReadFile(file)
+	}
+	ca, err := readFile(cfg.CAData, cfg.CAFile)
+	if err != nil {
+		return c, err
+	}
+	cert, err := readFile(cfg.CertData, cfg.CertFile)
+	if err != nil {
+		return c, err
+	}
+	key, err := readFile(cfg.KeyData, cfg.KeyFile)
+	if err != nil {
+		return c, err
+	}
+	token, err := readFile([]byte(cfg.BearerToken), cfg.BearerTokenFile)
+	if err != nil {
+		return c, err
+	}
+
+	if len(ca) > 0 || len(cert) > 0 || cfg.Insecure || cfg.ServerName != "" {
+		// Argo CD expects PEM data base64 encoded, as in a kubeconfig
+		c.Config.TLSClientConfig = &config.TLSClientConfig{
+			Insecure:   cfg.Insecure,
+			ServerName: cfg.ServerName,
+			CAData:     encodePEM(ca),
+			CertData:   encodePEM(cert),
+			KeyData:    encodePEM(key),
+		}
+	}
+	c.Config.BearerToken = strings.TrimSpace(string(token))
+	c.Config.Username = cfg.Username
+	c.Config.Password = cfg.Password
+	if e := cfg.ExecProvider; e != nil {
+		exec := &config.ExecProviderConfig{
+			Command:     e.Command,
+			Args:        e.Args,
+			APIVersion:  e.APIVersion,
+			InstallHint: e.InstallHint,
+		}
+		if len(e.Env) > 0 {
+			exec.Env = map[string]string{}
+			for _, v := range e.Env {
+				exec.Env[v.Name] = v.Value
+			}
+		}
+		c.Config.ExecProviderConfig = exec
+	}
+	return c, nil
+}
+
+func encodePEM(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// ClusterManagerObjects builds the ServiceAccount, ClusterRoleBinding and
+// long-lived token secret Argo CD uses to manage a registered cluster.
+// They are applied to the registered cluster, not the Argo CD one.
+func ClusterManagerObjects(ns, name, clusterRole string) []k8s.Object {
+	labels := map[string]interface{}{"managed-by": "rgo"}
+	sa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ServiceAccount",
+		"metadata":   map[string]interface{}{"name": name, "namespace": ns, "labels": labels},
+	}}
+	binding := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRoleBinding",
+		"metadata":   map[string]interface{}{"name": name + "-role-binding", "labels": labels},
+		"roleRef": map[string]interface{}{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "ClusterRole",
+			"name":     clusterRole,
+		},
+		"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": name, "namespace": ns},
+		},
+	}}
+	// since Kubernetes 1.24 service accounts get no token secret on their own
+	token := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "kubernetes.io/service-account-token",
+		"metadata": map[string]interface{}{
+			"name":        name + "-token",
+			"namespace":   ns,
+			"labels":      labels,
+			"annotations": map[string]interface{}{"kubernetes.io/service-account.name": name},
+		},
+	}}
+	return []k8s.Object{
+		{Obj: sa, GVR: GVRServiceAccount, NS: ns},
+		{Obj: binding, GVR: GVRClusterRoleBinding},
+		{Obj: token, GVR: GVRSecret, NS: ns},
+	}
+}
+
+// ServiceAccountToken reads the token and CA the token controller filled into
+// a service account token secret. ok is false until both are present.
+func ServiceAccountToken(secret *unstructured.Unstructured) (token, caData string, ok bool) {
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	b, err := base64.StdEncoding.DecodeString(data["token"])
+	if err != nil || len(b) == 0 || data["ca.crt"] == "" {
+		return "", "", false
+	}
+	// ca.crt is already base64 encoded PEM, the form caData expects
+	return string(b), data["ca.crt"], true
+}
+
+// ClusterPlaceholders replaces the credentials of a cluster entry, including
+// the environment of its exec plugin, with ${ENV} placeholders so it can be
+// committed, and returns the values to export.
+func ClusterPlaceholders(c config.Cluster) (config.Cluster, map[string]string) {
+	env := map[string]string{}
+	prefix := "CLUSTER_" + envPrefix(c.Name)
+	replace := func(value *string, suffix string) {
+		if *value == "" {
+			return
+		}
+		env[prefix+"_"+suffix] = *value
+		*value = "${" + prefix + "_" + suffix + "}"
+	}
+	replace(&c.Config.BearerToken, "TOKEN")
+	replace(&c.Config.Password, "PASSWORD")
+	if t := c.Config.TLSClientConfig; t != nil {
+		tls := *t
+		replace(&tls.CertData, "CERT_DATA")
+		replace(&tls.KeyData, "KEY_DATA")
+		c.Config.TLSClientConfig = &tls
+	}
+	// exec plugins commonly read tokens and keys from their environment
+	if e := c.Config.ExecProviderConfig; e != nil && len(e.Env) > 0 {
+		exec := *e
+		exec.Env = map[string]string{}
+		for k, v := range e.Env {
+			replace(&v, "EXEC_"+envPrefix(k))
+			exec.Env[k] = v
+		}
+		c.Config.ExecProviderConfig = &exec
+	}
+	return c, env
+}
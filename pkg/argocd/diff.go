@@ -0,0 +1,130 @@
+package argocd
+
+import (
+	"encoding/base64"
+
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	redacted        = "<redacted>"
+	redactedChanged = "<redacted, changed>"
+)
+
+// plainSecretKeys are Argo CD secret keys that hold no credentials and are
+// therefore shown in clear text when diffing.
+var plainSecretKeys = map[string]bool{
+	"url":       true,
+	"type":      true,
+	"name":      true,
+	"project":   true,
+	"enableOCI": true,
+	// cluster secrets
+	"server":           true,
+	"namespaces":       true,
+	"clusterResources": true,
+}
+
+// NormalizeForDiff returns a copy of obj without the fields populated by the
+// API server or stamped on every run by rgo. Secret data is decoded and merged
+// with stringData so live and desired secrets compare equal.
+func NormalizeForDiff(obj *unstructured.Unstructured) (map[string]interface{}, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	u, err := k8s.CopyObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := u.Object
+
+	delete(m, "status")
+	delete(m, "operation")
+	if md, ok := m["metadata"].(map[string]interface{}); ok {
+		for _, f := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"} {
+			delete(md, f)
+		}
+		if labels, ok := md["labels"].(map[string]interface{}); ok {
+			delete(labels, k8s.LabelCreatedAt)
+			if len(labels) == 0 {
+				delete(md, "labels")
+			}
+		}
+		if annotations, ok := md["annotations"].(map[string]interface{}); ok {
+			delete(annotations, k8s.AnnotationUpdatedAt)
+			delete(annotations, k8s.AnnotationContentHash)
+			if len(annotations) == 0 {
+				delete(md, "annotations")
+			}
+		}
+	}
+
+	if m["kind"] == "Secret" {
+		data := map[string]interface{}{}
+		if raw, ok := m["data"].(map[string]interface{}); ok {
+			for k, v := range raw {
+				s, _ := v.(string)
+				decoded, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, err
+				}
+				data[k] = string(decoded)
+			}
+		}
+		if raw, ok := m["stringData"].(map[string]interface{}); ok {
+			for k, v := range raw {
+				data[k] = v
+			}
+		}
+		delete(m, "stringData")
+		delete(m, "data")
+		if len(data) > 0 {
+			m["data"] = data
+		}
+		// defaulted by the API server
+		if m["type"] == "Opaque" {
+			delete(m, "type")
+		}
+	}
+	return m, nil
+}
+
+// RedactSecrets replaces credential values in normalized live and desired
+// secrets with placeholders, keeping changed values distinguishable.
+// Either argument may be nil.
+func RedactSecrets(live, desired map[string]interface{}) {
+	liveData := secretData(live)
+	desiredData := secretData(desired)
+
+	for k, lv := range liveData {
+		if plainSecretKeys[k] {
+			continue
+		}
+		liveData[k] = redacted
+		if dv, ok := desiredData[k]; ok {
+			if dv == lv {
+				desiredData[k] = redacted
+			} else {
+				desiredData[k] = redactedChanged
+			}
+		}
+	}
+	for k := range desiredData {
+		if plainSecretKeys[k] {
+			continue
+		}
+		if _, ok := liveData[k]; !ok {
+			desiredData[k] = redactedChanged
+		}
+	}
+}
+
+func secretData(m map[string]interface{}) map[string]interface{} {
+	if m == nil || m["kind"] != "Secret" {
+		return nil
+	}
+	data, _ := m["data"].(map[string]interface{})
+	return data
+}
@@ -0,0 +1,552 @@
+package argocd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zcubbs/rgo/pkg/config"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SecretTypeLabel marks the secrets Argo CD reads repositories and credentials from
+const SecretTypeLabel = "argocd.argoproj.io/secret-type"
+
+// ImportApplication converts a live Application into its config form. The
+// returned warnings name fields the config model cannot represent.
+func ImportApplication(obj *unstructured.Unstructured) (config.Application, []string) {
+	var warn []string
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	a := config.Application{
+		Name:    obj.GetName(),
+		Project: str(spec, "project"),
+	}
+
+	dest, _, _ := unstructured.NestedMap(spec, "destination")
+	a.DestinationServer = str(dest, "server")
+	a.DestinationNamespace = str(dest, "namespace")
+	warn = append(warn, unknownKeys("spec.destination", dest, "server", "namespace")...)
+
+	if source, ok := spec["source"].(map[string]interface{}); ok && source["chart"] != nil {
+		// the single source fields have no chart, but a one-entry sources
+		// list builds the same source
+		src, sw := importSource("spec.source", source)
+		a.Sources = []config.Source{src}
+		warn = append(warn, sw...)
+		warn = append(warn, "spec.source: the chart is imported as a one-entry sources list, which apply writes as spec.sources")
+	} else if ok {
+		a.SourceRepoURL = str(source, "repoURL")
+		a.SourcePath = str(source, "path")
+		a.TargetRevision = importRevision(str(source, "targetRevision"))
+		if helm, ok := source["helm"].(map[string]interface{}); ok {
+			var hw []string
+			a.IsHelm = true
+			a.HelmValueFiles, a.Helm, hw = importHelm("spec.source.helm", helm)
+			warn = append(warn, hw...)
+		}
+		if kustomize, ok := source["kustomize"].(map[string]interface{}); ok {
+			var kw []string
+			a.Kustomize, kw = importKustomize("spec.source.kustomize", kustomize)
+			warn = append(warn, kw...)
+		}
+		a.Directory, a.Plugin = importDirectoryAndPlugin("spec.source", source, &warn)
+		warn = append(warn, unknownKeys("spec.source", source, "repoURL", "path", "targetRevision", "helm", "kustomize", "directory", "plugin")...)
+	} else if sources, ok := spec["sources"].([]interface{}); ok {
+		warn = append(warn, importSources(&a, sources)...)
+	}
+
+	a.SyncPolicy, warn = importSyncPolicy(spec, warn)
+	warn = append(warn, unknownKeys("spec", spec, "project", "destination", "source", "sources", "syncPolicy")...)
+	return a, warn
+}
+
+func importSources(a *config.Application, sources []interface{}) []string {
+	var warn []string
+	for i, raw := range sources {
+		m, _ := raw.(map[string]interface{})
+		src, sw := importSource(fmt.Sprintf("spec.sources[%d]", i), m)
+		a.Sources = append(a.Sources, src)
+		warn = append(warn, sw...)
+	}
+	return warn
+}
+
+// importSource converts one source into the form of a multi-source entry
+func importSource(path string, m map[string]interface{}) (config.Source, []string) {
+	var warn []string
+	src := config.Source{
+		RepoURL:        str(m, "repoURL"),
+		Path:           str(m, "path"),
+		Chart:          str(m, "chart"),
+		TargetRevision: str(m, "targetRevision"),
+		Ref:            str(m, "ref"),
+	}
+	if helm, ok := m["helm"].(map[string]interface{}); ok {
+		src.Type = config.SourceTypeHelm
+		if enabled, _ := helm["enableOCI"].(bool); enabled {
+			src.Type = config.SourceTypeOCI
+		}
+		var hw []string
+		src.HelmValueFiles, src.Helm, hw = importHelm(path+".helm", helm)
+		warn = append(warn, hw...)
+	} else if kustomize, ok := m["kustomize"].(map[string]interface{}); ok {
+		var kw []string
+		src.Type = config.SourceTypeKustomize
+		src.Kustomize, kw = importKustomize(path+".kustomize", kustomize)
+		warn = append(warn, kw...)
+	}
+	if src.SourceType() != config.SourceTypeHelm && src.SourceType() != config.SourceTypeOCI {
+		src.TargetRevision = importRevision(src.TargetRevision)
+	}
+	// leave the type implicit when it would be inferred anyway
+	implicit := src
+	implicit.Type = ""
+	if implicit.SourceType() == src.Type {
+		src.Type = ""
+	}
+	src.Directory, src.Plugin = importDirectoryAndPlugin(path, m, &warn)
+	warn = append(warn, unknownKeys(path, m, "repoURL", "path", "chart", "targetRevision", "ref", "helm", "kustomize", "directory", "plugin")...)
+	return src, warn
+}
+
+// importDirectoryAndPlugin reads the directory and plugin blocks of a source
+func importDirectoryAndPlugin(path string, source map[string]interface{}, warn *[]string) (*config.Directory, *config.Plugin) {
+	var dir *config.Directory
+	if d, ok := source["directory"].(map[string]interface{}); ok {
+		dir = &config.Directory{Include: str(d, "include"), Exclude: str(d, "exclude")}
+		dir.Recurse, _ = d["recurse"].(bool)
+		if j, ok := d["jsonnet"].(map[string]interface{}); ok {
+			dir.Jsonnet = &config.Jsonnet{
+				TLAs:    importJsonnetVars(j, "tlas"),
+				ExtVars: importJsonnetVars(j, "extVars"),
+				Libs:    strs(j, "libs"),
+			}
+			*warn = append(*warn, unknownKeys(path+".directory.jsonnet", j, "tlas", "extVars", "libs")...)
+		}
+		*warn = append(*warn, unknownKeys(path+".directory", d, "recurse", "include", "exclude", "jsonnet")...)
+	}
+
+	var plugin *config.Plugin
+	if p, ok := source["plugin"].(map[string]interface{}); ok {
+		plugin = &config.Plugin{Name: str(p, "name")}
+		env, _ := p["env"].([]interface{})
+		for _, e := range env {
+			em, _ := e.(map[string]interface{})
+			plugin.Env = append(plugin.Env, config.PluginEnv{Name: str(em, "name"), Value: str(em, "value")})
+		}
+		params, _ := p["parameters"].([]interface{})
+		for _, raw := range params {
+			pm, _ := raw.(map[string]interface{})
+			plugin.Parameters = append(plugin.Parameters, config.PluginParameter{
+				Name:   str(pm, "name"),
+				String: str(pm, "string"),
+				Array:  strs(pm, "array"),
+				Map:    strMap(pm, "map"),
+			})
+		}
+		*warn = append(*warn, unknownKeys(path+".plugin", p, "name", "env", "parameters")...)
+	}
+	return dir, plugin
+}
+
+func importJsonnetVars(m map[string]interface{}, key string) []config.JsonnetVar {
+	list, _ := m[key].([]interface{})
+	var out []config.JsonnetVar
+	for _, raw := range list {
+		vm, _ := raw.(map[string]interface{})
+		code, _ := vm["code"].(bool)
+		out = append(out, config.JsonnetVar{Name: str(vm, "name"), Value: str(vm, "value"), Code: code})
+	}
+	return out
+}
+
+// importHelm splits a helm block into value files and the remaining options,
+// which are nil when rgo's defaults already produce them
+func importHelm(path string, m map[string]interface{}) ([]string, *config.Helm, []string) {
+	h := &config.Helm{
+		Values:      str(m, "values"),
+		ReleaseName: str(m, "releaseName"),
+		Version:     str(m, "version"),
+	}
+	if obj, ok := m["valuesObject"].(map[string]interface{}); ok && len(obj) > 0 {
+		h.ValuesObject = obj
+	}
+	h.SkipCrds, _ = m["skipCrds"].(bool)
+	h.IgnoreMissingValueFiles, _ = m["ignoreMissingValueFiles"].(bool)
+	if pass, ok := m["passCredentials"].(bool); !ok || !pass {
+		// rgo passes credentials unless told otherwise
+		h.PassCredentials = &pass
+	}
+	params, _ := m["parameters"].([]interface{})
+	for _, p := range params {
+		pm, _ := p.(map[string]interface{})
+		force, _ := pm["forceString"].(bool)
+		h.Parameters = append(h.Parameters, config.HelmParameter{Name: str(pm, "name"), Value: str(pm, "value"), ForceString: force})
+	}
+	fileParams, _ := m["fileParameters"].([]interface{})
+	for _, p := range fileParams {
+		pm, _ := p.(map[string]interface{})
+		h.FileParameters = append(h.FileParameters, config.HelmFileParameter{Name: str(pm, "name"), Path: str(pm, "path")})
+	}
+
+	warn := unknownKeys(path, m, "valueFiles", "passCredentials", "enableOCI", "values", "valuesObject",
+		"parameters", "fileParameters", "releaseName", "skipCrds", "ignoreMissingValueFiles", "version")
+	if reflect.DeepEqual(*h, config.Helm{}) {
+		h = nil
+	}
+	return strs(m, "valueFiles"), h, warn
+}
+
+func importKustomize(path string, m map[string]interface{}) (*config.Kustomize, []string) {
+	k := &config.Kustomize{
+		NamePrefix:        str(m, "namePrefix"),
+		NameSuffix:        str(m, "nameSuffix"),
+		Namespace:         str(m, "namespace"),
+		Version:           str(m, "version"),
+		Images:            strs(m, "images"),
+		CommonLabels:      strMap(m, "commonLabels"),
+		CommonAnnotations: strMap(m, "commonAnnotations"),
+	}
+	replicas, _ := m["replicas"].([]interface{})
+	for _, r := range replicas {
+		rm, _ := r.(map[string]interface{})
+		k.Replicas = append(k.Replicas, config.KustomizeReplica{Name: str(rm, "name"), Count: num(rm, "count")})
+	}
+	patches, _ := m["patches"].([]interface{})
+	for _, p := range patches {
+		pm, _ := p.(map[string]interface{})
+		patch := config.KustomizePatch{Patch: str(pm, "patch"), Path: str(pm, "path")}
+		if t, ok := pm["target"].(map[string]interface{}); ok {
+			patch.Target = &config.KustomizeTarget{
+				Group:              str(t, "group"),
+				Version:            str(t, "version"),
+				Kind:               str(t, "kind"),
+				Name:               str(t, "name"),
+				Namespace:          str(t, "namespace"),
+				LabelSelector:      str(t, "labelSelector"),
+				AnnotationSelector: str(t, "annotationSelector"),
+			}
+		}
+		if opts, ok := pm["options"].(map[string]interface{}); ok {
+			patch.Options = map[string]bool{}
+			for key, v := range opts {
+				patch.Options[key], _ = v.(bool)
+			}
+		}
+		k.Patches = append(k.Patches, patch)
+	}
+	return k, unknownKeys(path, m, "namePrefix", "nameSuffix", "namespace", "version", "images",
+		"commonLabels", "commonAnnotations", "replicas", "patches")
+}
+
+func importSyncPolicy(spec map[string]interface{}, warn []string) (config.SyncPolicy, []string) {
+	sp, ok := spec["syncPolicy"].(map[string]interface{})
+	if !ok {
+		return config.SyncPolicy{Mode: config.SyncModeManual}, warn
+	}
+
+	p := config.SyncPolicy{Mode: config.SyncModeManual}
+	if auto, ok := sp["automated"].(map[string]interface{}); ok {
+		p.Mode = config.SyncModeAutomated
+		// prune and selfHeal default to true in rgo but false in Argo CD
+		prune, _ := auto["prune"].(bool)
+		selfHeal, _ := auto["selfHeal"].(bool)
+		if !prune {
+			p.Prune = &prune
+		}
+		if !selfHeal {
+			p.SelfHeal = &selfHeal
+		}
+		p.AllowEmpty, _ = auto["allowEmpty"].(bool)
+		warn = append(warn, unknownKeys("spec.syncPolicy.automated", auto, "prune", "selfHeal", "allowEmpty")...)
+	}
+	p.SyncOptions = strs(sp, "syncOptions")
+	if retry, ok := sp["retry"].(map[string]interface{}); ok {
+		p.Retry = &config.Retry{Limit: num(retry, "limit")}
+		if b, ok := retry["backoff"].(map[string]interface{}); ok {
+			p.Retry.Backoff = &config.Backoff{
+				Duration:    str(b, "duration"),
+				Factor:      num(b, "factor"),
+				MaxDuration: str(b, "maxDuration"),
+			}
+		}
+	}
+	warn = append(warn, unknownKeys("spec.syncPolicy", sp, "automated", "syncOptions", "retry")...)
+	return p, warn
+}
+
+// ImportProject converts a live AppProject into its config form
+func ImportProject(obj *unstructured.Unstructured) (config.Project, []string) {
+	var warn []string
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	p := config.Project{
+		Name:        obj.GetName(),
+		Description: str(spec, "description"),
+		SourceRepos: strs(spec, "sourceRepos"),
+	}
+	dests, _ := spec["destinations"].([]interface{})
+	for i, d := range dests {
+		m, _ := d.(map[string]interface{})
+		p.Destinations = append(p.Destinations, config.Destination{
+			Server:    str(m, "server"),
+			Namespace: str(m, "namespace"),
+			Name:      str(m, "name"),
+		})
+		warn = append(warn, unknownKeys(fmt.Sprintf("spec.destinations[%d]", i), m, "server", "namespace", "name")...)
+	}
+	p.SourceNamespaces = strs(spec, "sourceNamespaces")
+	p.ClusterResourceWhitelist = importGroupKinds(spec, "clusterResourceWhitelist")
+	p.ClusterResourceBlacklist = importGroupKinds(spec, "clusterResourceBlacklist")
+	p.NamespaceResourceWhitelist = importGroupKinds(spec, "namespaceResourceWhitelist")
+	p.NamespaceResourceBlacklist = importGroupKinds(spec, "namespaceResourceBlacklist")
+
+	if o, ok := spec["orphanedResources"].(map[string]interface{}); ok {
+		p.OrphanedResources = &config.OrphanedResources{}
+		p.OrphanedResources.Warn, _ = o["warn"].(bool)
+		ignore, _ := o["ignore"].([]interface{})
+		for _, k := range ignore {
+			m, _ := k.(map[string]interface{})
+			p.OrphanedResources.Ignore = append(p.OrphanedResources.Ignore, config.OrphanedResourceKey{
+				Group: str(m, "group"), Kind: str(m, "kind"), Name: str(m, "name"),
+			})
+		}
+		warn = append(warn, unknownKeys("spec.orphanedResources", o, "warn", "ignore")...)
+	}
+
+	keys, _ := spec["signatureKeys"].([]interface{})
+	for _, k := range keys {
+		m, _ := k.(map[string]interface{})
+		p.SignatureKeys = append(p.SignatureKeys, str(m, "keyID"))
+	}
+
+	roles, _ := spec["roles"].([]interface{})
+	for i, r := range roles {
+		m, _ := r.(map[string]interface{})
+		p.Roles = append(p.Roles, config.ProjectRole{
+			Name:        str(m, "name"),
+			Description: str(m, "description"),
+			Policies:    strs(m, "policies"),
+			Groups:      strs(m, "groups"),
+		})
+		// issued tokens belong to Argo CD, not to the config
+		warn = append(warn, unknownKeys(fmt.Sprintf("spec.roles[%d]", i), m, "name", "description", "policies", "groups", "jwtTokens")...)
+	}
+
+	windows, _ := spec["syncWindows"].([]interface{})
+	for i, w := range windows {
+		m, _ := w.(map[string]interface{})
+		window := config.SyncWindow{
+			Kind:         str(m, "kind"),
+			Schedule:     str(m, "schedule"),
+			Duration:     str(m, "duration"),
+			Applications: strs(m, "applications"),
+			Namespaces:   strs(m, "namespaces"),
+			Clusters:     strs(m, "clusters"),
+			TimeZone:     str(m, "timeZone"),
+		}
+		window.ManualSync, _ = m["manualSync"].(bool)
+		p.SyncWindows = append(p.SyncWindows, window)
+		warn = append(warn, unknownKeys(fmt.Sprintf("spec.syncWindows[%d]", i), m,
+			"kind", "schedule", "duration", "applications", "namespaces", "clusters", "manualSync", "timeZone")...)
+	}
+
+	warn = append(warn, unknownKeys("spec", spec, "description", "sourceRepos", "destinations", "sourceNamespaces",
+		"clusterResourceWhitelist", "clusterResourceBlacklist", "namespaceResourceWhitelist", "namespaceResourceBlacklist",
+		"orphanedResources", "signatureKeys", "roles", "syncWindows")...)
+	return p, warn
+}
+
+func importGroupKinds(spec map[string]interface{}, key string) []config.GroupKind {
+	list, _ := spec[key].([]interface{})
+	var out []config.GroupKind
+	for _, v := range list {
+		m, _ := v.(map[string]interface{})
+		out = append(out, config.GroupKind{Group: str(m, "group"), Kind: str(m, "kind")})
+	}
+	return out
+}
+
+// ImportRepository converts a live repository secret into its config form.
+// Credentials are replaced by ${ENV} placeholders, returned in env.
+func ImportRepository(obj *unstructured.Unstructured) (r config.Repository, env []string, warn []string) {
+	data := secretStrings(obj)
+	r = config.Repository{URL: data["url"], Type: data["type"]}
+	if r.Type == "helm" && data["enableOCI"] == "true" {
+		r.Type = "oci"
+	}
+	if r.Type == "git" || r.Type == "" {
+		// git is the default
+		r.Type = "git"
+	}
+
+	var ok bool
+	if r.Name, ok = importSecretName(obj.GetName(), r.URL); !ok {
+		warn = append(warn, fmt.Sprintf("metadata.name: %q will be renamed to repo-%s", obj.GetName(), r.Name))
+	}
+	if r.Type == "git" {
+		if url := ensureGitSuffix(r.URL); url != r.URL {
+			warn = append(warn, fmt.Sprintf("data.url: %q will be applied as %q", r.URL, url))
+		}
+	}
+
+	prefix := envPrefix(obj.GetName())
+	if data["username"] != "" {
+		r.Username = placeholder(prefix+"_USERNAME", &env)
+	}
+	if data["password"] != "" {
+		r.Password = placeholder(prefix+"_PASSWORD", &env)
+	}
+	if data["sshPrivateKey"] != "" {
+		r.SSHKey = placeholder(prefix+"_SSH_KEY", &env)
+	}
+	if pass, ok := data["passCredentials"]; ok {
+		warn = append(warn, fmt.Sprintf("data.passCredentials: %q is dropped; set helm.passCredentials on the applications using this repository instead", pass))
+	}
+	warn = append(warn, unknownSecretKeys(data, "url", "type", "name", "enableOCI", "username", "password", "sshPrivateKey", "passCredentials")...)
+	return r, env, warn
+}
+
+// ImportCredential converts a live credential secret into its config form.
+// Credentials are replaced by ${ENV} placeholders, returned in env.
+func ImportCredential(obj *unstructured.Unstructured) (c config.Credential, env []string, warn []string) {
+	data := secretStrings(obj)
+	c = config.Credential{URL: data["url"], Type: data["type"]}
+	if c.Type == "helm" && data["enableOCI"] == "true" {
+		c.Type = "oci"
+	}
+
+	var ok bool
+	if c.Name, ok = importSecretName(obj.GetName(), c.URL); !ok {
+		warn = append(warn, fmt.Sprintf("metadata.name: %q will be renamed to repo-%s", obj.GetName(), c.Name))
+	}
+
+	prefix := envPrefix(obj.GetName())
+	if data["username"] != "" {
+		c.Username = placeholder(prefix+"_USERNAME", &env)
+	}
+	if data["password"] != "" {
+		c.Password = placeholder(prefix+"_PASSWORD", &env)
+	}
+	if data["sshPrivateKey"] != "" {
+		c.SSHKey = placeholder(prefix+"_SSH_KEY", &env)
+	}
+	warn = append(warn, unknownSecretKeys(data, "url", "type", "enableOCI", "username", "password", "sshPrivateKey")...)
+	return c, env, warn
+}
+
+// importSecretName derives the config name that rebuilds secretName, reporting
+// false when the secret cannot keep its name
+func importSecretName(secretName, url string) (string, bool) {
+	if secretName == secretNameFromURL(url) {
+		return "", true
+	}
+	if name, ok := strings.CutPrefix(secretName, "repo-"); ok {
+		return name, true
+	}
+	return secretName, false
+}
+
+func importRevision(rev string) string {
+	// HEAD is what BuildApplications defaults to
+	if rev == "HEAD" {
+		return ""
+	}
+	return rev
+}
+
+var nonAlnum = regexp.MustCompile(`[^A-Z0-9]+`)
+
+func envPrefix(name string) string {
+	return strings.Trim(nonAlnum.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+func placeholder(name string, env *[]string) string {
+	*env = append(*env, name)
+	return "${" + name + "}"
+}
+
+// secretStrings merges the decoded data and stringData of a secret
+func secretStrings(obj *unstructured.Unstructured) map[string]string {
+	out := map[string]string{}
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	for k, v := range data {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err == nil {
+			out[k] = string(b)
+		}
+	}
+	stringData, _, _ := unstructured.NestedStringMap(obj.Object, "stringData")
+	for k, v := range stringData {
+		out[k] = v
+	}
+	return out
+}
+
+func unknownSecretKeys(data map[string]string, known ...string) []string {
+	m := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		m[k] = v
+	}
+	return unknownKeys("data", m, known...)
+}
+
+// unknownKeys reports the keys of m, under path, that are not in known
+func unknownKeys(path string, m map[string]interface{}, known ...string) []string {
+	var out []string
+	for k := range m {
+		found := false
+		for _, kk := range known {
+			if k == kk {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, fmt.Sprintf("%s.%s is not supported by rgo", path, k))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func str(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func strs(m map[string]interface{}, key string) []string {
+	list, _ := m[key].([]interface{})
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func strMap(m map[string]interface{}, key string) map[string]string {
+	raw, _ := m[key].(map[string]interface{})
+	if len(raw) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		out[k], _ = v.(string)
+	}
+	return out
+}
+
+func num(m map[string]interface{}, key string) int64 {
+	switch v := m[key].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
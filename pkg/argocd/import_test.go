@@ -0,0 +1,130 @@
+package argocd
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zcubbs/rgo/pkg/config"
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func repositorySecret(name string, data map[string]string) *unstructured.Unstructured {
+	encoded := map[string]interface{}{}
+	for k, v := range data {
+		encoded[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{SecretTypeLabel: "repository"},
+		},
+		"data": encoded,
+	}}
+}
+
+func TestImportRepositoryWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		want []string
+	}{
+		{
+			name: "git URL without suffix",
+			data: map[string]string{"url": "https://github.com/x/y", "type": "git"},
+			want: []string{`data.url: "https://github.com/x/y" will be applied as "https://github.com/x/y.git"`},
+		},
+		{
+			name: "git URL with suffix",
+			data: map[string]string{"url": "https://github.com/x/y.git", "type": "git"},
+		},
+		{
+			name: "helm URL",
+			data: map[string]string{"url": "https://charts.example.com", "type": "helm"},
+		},
+		{
+			name: "passCredentials",
+			data: map[string]string{"url": "https://charts.example.com", "type": "helm", "passCredentials": "false"},
+			want: []string{`data.passCredentials: "false" is dropped; set helm.passCredentials on the applications using this repository instead`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, warn := ImportRepository(repositorySecret("repo-y", tt.data))
+			if strings.Join(warn, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("warnings = %q, want %q", warn, tt.want)
+			}
+		})
+	}
+}
+
+// An imported application must build back into the spec it was imported from.
+func TestImportApplicationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string // the built spec when it differs in form from the live one
+	}{
+		{
+			name: "git path",
+			spec: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"source": {"repoURL": "https://github.com/x/y.git", "path": "web", "targetRevision": "main"},
+				"syncPolicy": {"automated": {"prune": true, "selfHeal": false, "allowEmpty": false}, "syncOptions": ["CreateNamespace=true"]}}`,
+		},
+		{
+			name: "helm chart in git",
+			spec: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"source": {"repoURL": "https://github.com/x/y.git", "path": "charts/web", "targetRevision": "HEAD",
+					"helm": {"passCredentials": true, "valueFiles": ["values-prod.yaml"], "releaseName": "web"}}}`,
+		},
+		{
+			name: "helm repository chart",
+			spec: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"source": {"repoURL": "https://charts.example.com", "chart": "web", "targetRevision": "1.2.3",
+					"helm": {"passCredentials": false, "valueFiles": ["values.yaml"]}}}`,
+			want: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"sources": [{"repoURL": "https://charts.example.com", "chart": "web", "targetRevision": "1.2.3",
+					"helm": {"passCredentials": false, "valueFiles": ["values.yaml"]}}]}`,
+		},
+		{
+			name: "OCI chart",
+			spec: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"source": {"repoURL": "registry.example.com/charts", "chart": "web", "targetRevision": "1.2.3",
+					"helm": {"passCredentials": true, "enableOCI": true}}}`,
+			want: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"sources": [{"repoURL": "registry.example.com/charts", "chart": "web", "targetRevision": "1.2.3",
+					"helm": {"passCredentials": true, "enableOCI": true}}]}`,
+		},
+		{
+			name: "multiple sources",
+			spec: `{"project": "team", "destination": {"server": "https://kubernetes.default.svc", "namespace": "web"},
+				"sources": [
+					{"repoURL": "https://charts.example.com", "chart": "web", "targetRevision": "1.2.3",
+						"helm": {"passCredentials": true, "valueFiles": ["$values/web/values.yaml"]}},
+					{"repoURL": "https://github.com/x/y.git", "targetRevision": "main", "ref": "values"}
+				]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := liveApplication(t, `{"metadata": {"name": "web"}, "spec": `+tt.spec+`}`)
+			a, _ := ImportApplication(live)
+			built, err := k8s.CopyObject(BuildApplications([]config.Application{a}, "argocd")[0].Obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := live.Object["spec"]
+			if tt.want != "" {
+				want = liveApplication(t, tt.want).Object
+			}
+			if got := built.Object["spec"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("built spec = %v\nwant %v", got, want)
+			}
+		})
+	}
+}
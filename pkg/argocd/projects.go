@@ -8,7 +8,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-var gvrAppProject = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "appprojects"}
+var GVRAppProject = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "appprojects"}
 
 func BuildProjects(projects []config.Project, ns string) []k8s.Object {
 	out := make([]k8s.Object, 0, len(projects))
@@ -21,25 +21,140 @@ func BuildProjects(projects []config.Project, ns string) []k8s.Object {
 				"namespace": ns,
 				"labels": map[string]interface{}{
 					"managed-by": "rgo",
-					"created-at": getTimestamp(),
 				},
 			},
-			"spec": map[string]interface{}{
-				"description": p.Description,
-				"sourceRepos": p.SourceRepos,
-				"destinations": func() []interface{} {
-					out := make([]interface{}, 0, len(p.Destinations))
-					for _, d := range p.Destinations {
-						out = append(out, map[string]interface{}{
-							"server":    d.Server,
-							"namespace": d.Namespace,
-						})
-					}
-					return out
-				}(),
-			},
+			"spec": buildProjectSpec(p),
 		}}
-		out = append(out, k8s.Object{Obj: obj, GVR: gvrAppProject, NS: ns})
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRAppProject, NS: ns})
 	}
 	return out
 }
+
+// PreserveRoleTokens copies the jwtTokens argocd-server records on the roles
+// of a live AppProject into the desired one. spec.roles is an atomic list, so
+// applying roles without them conflicts with argocd-server, or with
+// --force-conflicts erases the records of issued tokens.
+func PreserveRoleTokens(obj, live *unstructured.Unstructured) {
+	if live == nil || obj.GetKind() != "AppProject" {
+		return
+	}
+	liveRoles, _, _ := unstructured.NestedSlice(live.Object, "spec", "roles")
+	tokens := map[string]interface{}{}
+	for _, r := range liveRoles {
+		role, _ := r.(map[string]interface{})
+		if name, ok := role["name"].(string); ok && role["jwtTokens"] != nil {
+			tokens[name] = role["jwtTokens"]
+		}
+	}
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	roles, _ := spec["roles"].([]interface{})
+	for _, r := range roles {
+		role, _ := r.(map[string]interface{})
+		if name, ok := role["name"].(string); ok && tokens[name] != nil {
+			role["jwtTokens"] = tokens[name]
+		}
+	}
+}
+
+func buildProjectSpec(p config.Project) map[string]interface{} {
+	spec := map[string]interface{}{
+		"description": p.Description,
+		"sourceRepos": p.SourceRepos,
+		"destinations": func() []interface{} {
+			out := make([]interface{}, 0, len(p.Destinations))
+			for _, d := range p.Destinations {
+				dest := map[string]interface{}{"namespace": d.Namespace}
+				setString(dest, "server", d.Server)
+				setString(dest, "name", d.Name)
+				out = append(out, dest)
+			}
+			return out
+		}(),
+	}
+	if len(p.SourceNamespaces) > 0 {
+		spec["sourceNamespaces"] = toInterfaces(p.SourceNamespaces)
+	}
+	setGroupKinds(spec, "clusterResourceWhitelist", p.ClusterResourceWhitelist)
+	setGroupKinds(spec, "clusterResourceBlacklist", p.ClusterResourceBlacklist)
+	setGroupKinds(spec, "namespaceResourceWhitelist", p.NamespaceResourceWhitelist)
+	setGroupKinds(spec, "namespaceResourceBlacklist", p.NamespaceResourceBlacklist)
+
+	if o := p.OrphanedResources; o != nil {
+		orphaned := map[string]interface{}{"warn": o.Warn}
+		if len(o.Ignore) > 0 {
+			ignore := make([]interface{}, 0, len(o.Ignore))
+			for _, k := range o.Ignore {
+				key := map[string]interface{}{}
+				setString(key, "group", k.Group)
+				setString(key, "kind", k.Kind)
+				setString(key, "name", k.Name)
+				ignore = append(ignore, key)
+			}
+			orphaned["ignore"] = ignore
+		}
+		spec["orphanedResources"] = orphaned
+	}
+
+	if len(p.SignatureKeys) > 0 {
+		keys := make([]interface{}, 0, len(p.SignatureKeys))
+		for _, k := range p.SignatureKeys {
+			keys = append(keys, map[string]interface{}{"keyID": k})
+		}
+		spec["signatureKeys"] = keys
+	}
+
+	if len(p.Roles) > 0 {
+		roles := make([]interface{}, 0, len(p.Roles))
+		for _, r := range p.Roles {
+			role := map[string]interface{}{"name": r.Name}
+			setString(role, "description", r.Description)
+			if len(r.Policies) > 0 {
+				role["policies"] = toInterfaces(r.Policies)
+			}
+			if len(r.Groups) > 0 {
+				role["groups"] = toInterfaces(r.Groups)
+			}
+			roles = append(roles, role)
+		}
+		spec["roles"] = roles
+	}
+
+	if len(p.SyncWindows) > 0 {
+		windows := make([]interface{}, 0, len(p.SyncWindows))
+		for _, w := range p.SyncWindows {
+			window := map[string]interface{}{
+				"kind":     w.Kind,
+				"schedule": w.Schedule,
+				"duration": w.Duration,
+			}
+			if len(w.Applications) > 0 {
+				window["applications"] = toInterfaces(w.Applications)
+			}
+			if len(w.Namespaces) > 0 {
+				window["namespaces"] = toInterfaces(w.Namespaces)
+			}
+			if len(w.Clusters) > 0 {
+				window["clusters"] = toInterfaces(w.Clusters)
+			}
+			if w.ManualSync {
+				window["manualSync"] = true
+			}
+			setString(window, "timeZone", w.TimeZone)
+			windows = append(windows, window)
+		}
+		spec["syncWindows"] = windows
+	}
+	return spec
+}
+
+// setGroupKinds sets a resource white- or blacklist; group "" is the core API
+func setGroupKinds(spec map[string]interface{}, key string, list []config.GroupKind) {
+	if len(list) == 0 {
+		return
+	}
+	out := make([]interface{}, 0, len(list))
+	for _, gk := range list {
+		out = append(out, map[string]interface{}{"group": gk.Group, "kind": gk.Kind})
+	}
+	spec[key] = out
+}
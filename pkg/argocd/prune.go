@@ -0,0 +1,51 @@
+package argocd
+
+import (
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ManagedSelector matches every object created by rgo
+	ManagedSelector = "managed-by=rgo"
+	// AnnotationPrune set to "false" protects an object from being pruned
+	AnnotationPrune = "rgo/prune"
+)
+
+// ManagedGVRs lists the resource types rgo creates, in safe deletion order
+func ManagedGVRs() []schema.GroupVersionResource {
+	return []schema.GroupVersionResource{GVRApplicationSet, GVRApplication, GVRAppProject, GVRSecret}
+}
+
+// Orphans returns the live objects that are no longer part of desired and are
+// not protected by the prune annotation
+func Orphans(live, desired []k8s.Object) []k8s.Object {
+	var out []k8s.Object
+	for _, o := range Difference(live, desired) {
+		if o.Obj.GetAnnotations()[AnnotationPrune] == "false" {
+			continue
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// Difference returns the objects of a that have no counterpart in b
+func Difference(a, b []k8s.Object) []k8s.Object {
+	seen := make(map[string]bool, len(b))
+	for _, o := range b {
+		seen[objectKey(o)] = true
+	}
+	var out []k8s.Object
+	for _, o := range a {
+		if !seen[objectKey(o)] {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func objectKey(o k8s.Object) string {
+	return o.GVR.String() + "/" + o.NS + "/" + o.Obj.GetName()
+}
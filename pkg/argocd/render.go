@@ -0,0 +1,35 @@
+package argocd
+
+import (
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RedactCredentials returns a copy of a built object with the credential
+// values of secrets replaced by a placeholder, and whether any were replaced.
+// Objects other than secrets are returned unchanged.
+func RedactCredentials(obj *unstructured.Unstructured) (*unstructured.Unstructured, bool, error) {
+	if obj.GetKind() != "Secret" {
+		return obj, false, nil
+	}
+	u, err := k8s.CopyObject(obj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	redactedAny := false
+	for _, field := range []string{"stringData", "data"} {
+		values, ok := u.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range values {
+			if !plainSecretKeys[k] {
+				values[k] = redacted
+				redactedAny = true
+			}
+		}
+	}
+	return u, redactedAny, nil
+}
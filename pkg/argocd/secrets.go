@@ -12,7 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-var gvrSecret = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
+var GVRSecret = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
 
 // ensureGitSuffix ensures that Git repository URLs end with .git
 func ensureGitSuffix(url string) string {
@@ -76,7 +76,7 @@ func BuildRepoSecrets(repos []config.Repository, ns string) []k8s.Object {
 
 		// Add SSH key if provided
 		if r.SSHKey != "" {
-			stringData["sshPrivateKey"] = r.SSHKey
+			stringData["sshPrivateKey"] = resolveEnvVar(r.SSHKey)
 		}
 
 		obj := &unstructured.Unstructured{Object: map[string]interface{}{
@@ -88,12 +88,11 @@ func BuildRepoSecrets(repos []config.Repository, ns string) []k8s.Object {
 				"labels": map[string]interface{}{
 					"argocd.argoproj.io/secret-type": "repository",
 					"managed-by":                     "rgo",
-					"created-at":                     getTimestamp(),
 				},
 			},
 			"stringData": stringData,
 		}}
-		out = append(out, k8s.Object{Obj: obj, GVR: gvrSecret, NS: ns})
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRSecret, NS: ns})
 	}
 	return out
 }
@@ -140,7 +139,18 @@ func BuildCredentialSecrets(creds []config.Credential, ns string) []k8s.Object {
 		} else {
 			name = secretNameFromURL(c.URL)
 		}
-		stringData := map[string]interface{}{"url": ensureGitSuffix(c.URL)}
+		// Credential templates match every repository under the URL prefix,
+		// so the URL must not get a .git suffix
+		stringData := map[string]interface{}{"url": c.URL}
+		switch c.Type {
+		case "helm":
+			stringData["type"] = "helm"
+		case "oci":
+			stringData["type"] = "helm"
+			stringData["enableOCI"] = "true"
+		default:
+			stringData["type"] = "git"
+		}
 		if c.Username != "" {
 			// Resolve environment variables in username
 			stringData["username"] = resolveEnvVar(c.Username)
@@ -150,7 +160,7 @@ func BuildCredentialSecrets(creds []config.Credential, ns string) []k8s.Object {
 			stringData["password"] = resolveEnvVar(c.Password)
 		}
 		if c.SSHKey != "" {
-			stringData["sshPrivateKey"] = c.SSHKey
+			stringData["sshPrivateKey"] = resolveEnvVar(c.SSHKey)
 		}
 		obj := &unstructured.Unstructured{Object: map[string]interface{}{
 			"apiVersion": "v1",
@@ -159,14 +169,32 @@ func BuildCredentialSecrets(creds []config.Credential, ns string) []k8s.Object {
 				"name":      name,
 				"namespace": ns,
 				"labels": map[string]interface{}{
-					"argocd.argoproj.io/secret-type": "repository",
+					"argocd.argoproj.io/secret-type": "repo-creds",
 					"managed-by":                     "rgo",
-					"created-at":                     getTimestamp(),
 				},
 			},
 			"stringData": stringData,
 		}}
-		out = append(out, k8s.Object{Obj: obj, GVR: gvrSecret, NS: ns})
+		out = append(out, k8s.Object{Obj: obj, GVR: GVRSecret, NS: ns})
+	}
+	return out
+}
+
+// MislabeledCredentials returns the live secrets that older rgo versions
+// created for credentials with the repository secret type. They are
+// relabelled before the repo-creds replacement with the same name is applied.
+func MislabeledCredentials(live, desired []k8s.Object) []k8s.Object {
+	creds := map[string]bool{}
+	for _, o := range desired {
+		if o.GVR == GVRSecret && o.Obj.GetLabels()[SecretTypeLabel] == "repo-creds" {
+			creds[objectKey(o)] = true
+		}
+	}
+	var out []k8s.Object
+	for _, o := range live {
+		if o.GVR == GVRSecret && creds[objectKey(o)] && o.Obj.GetLabels()[SecretTypeLabel] == "repository" {
+			out = append(out, o)
+		}
 	}
 	return out
 }
@@ -184,3 +212,22 @@ func secretNameFromURL(url string) string {
 	}
 	return fmt.Sprintf("repo-%s", name)
 }
+
+// ProjectTokenSecret stores a project role token for CI pipelines. It carries
+// no managed-by label, so pruning never removes it.
+func ProjectTokenSecret(name, ns, key, project, role, token string) k8s.Object {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": ns,
+			"annotations": map[string]interface{}{
+				"rgo/project": project,
+				"rgo/role":    role,
+			},
+		},
+		"stringData": map[string]interface{}{key: token},
+	}}
+	return k8s.Object{Obj: obj, GVR: GVRSecret, NS: ns}
+}
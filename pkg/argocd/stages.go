@@ -0,0 +1,50 @@
+package argocd
+
+import (
+	"fmt"
+
+	"github.com/zcubbs/rgo/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ApplyStages groups objects so that projects and repository and cluster
+// secrets exist before the applications and application sets that use them
+func ApplyStages(objs []k8s.Object) [][]k8s.Object {
+	var first, second []k8s.Object
+	for _, o := range objs {
+		switch o.Obj.GetKind() {
+		case "Application", "ApplicationSet":
+			second = append(second, o)
+		default:
+			first = append(first, o)
+		}
+	}
+	var stages [][]k8s.Object
+	for _, s := range [][]k8s.Object{first, second} {
+		if len(s) > 0 {
+			stages = append(stages, s)
+		}
+	}
+	return stages
+}
+
+// SkipDependent skips applications and application sets whose project failed
+// to apply: Argo CD would reject them until the project exists
+func SkipDependent(o k8s.Object, failed []k8s.Object) string {
+	var project string
+	switch o.Obj.GetKind() {
+	case "Application":
+		project, _, _ = unstructured.NestedString(o.Obj.Object, "spec", "project")
+	case "ApplicationSet":
+		project, _, _ = unstructured.NestedString(o.Obj.Object, "spec", "template", "spec", "project")
+	default:
+		return ""
+	}
+	for _, f := range failed {
+		if f.Obj.GetKind() == "AppProject" && f.Obj.GetName() == project {
+			return fmt.Sprintf("project %s was not applied", project)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package argocd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AppStatus is the sync and health state reported by Argo CD for an Application
+type AppStatus struct {
+	Name     string `json:"name"`
+	Project  string `json:"project"`
+	Sync     string `json:"sync"`
+	Health   string `json:"health"`
+	Revision string `json:"revision"`
+	Phase    string `json:"phase"`
+	Message  string `json:"message"`
+	// Resources holds the messages of resources that failed to sync or are
+	// unhealthy, as Kind/name: message
+	Resources []string `json:"resources,omitempty"`
+}
+
+// ApplicationStatus reads the status block of a live Application
+func ApplicationStatus(obj *unstructured.Unstructured) AppStatus {
+	str := func(fields ...string) string {
+		v, _, _ := unstructured.NestedString(obj.Object, fields...)
+		return v
+	}
+	s := AppStatus{
+		Name:     obj.GetName(),
+		Project:  str("spec", "project"),
+		Sync:     str("status", "sync", "status"),
+		Health:   str("status", "health", "status"),
+		Revision: str("status", "sync", "revision"),
+		Phase:    str("status", "operationState", "phase"),
+		Message:  str("status", "operationState", "message"),
+	}
+	if s.Message == "" {
+		s.Message = str("status", "health", "message")
+	}
+	// conditions carry errors such as invalid specs or missing repositories
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if s.Message == "" && len(conditions) > 0 {
+		if m, ok := conditions[0].(map[string]interface{}); ok {
+			s.Message = fmt.Sprintf("%v: %v", m["type"], m["message"])
+		}
+	}
+	s.Resources = resourceMessages(obj)
+	return s
+}
+
+// resourceMessages collects the messages of resources that failed to sync,
+// then of those that are degraded or missing
+func resourceMessages(obj *unstructured.Unstructured) []string {
+	var out []string
+	add := func(r map[string]interface{}, msg string) {
+		if msg != "" {
+			out = append(out, fmt.Sprintf("%v/%v: %s", r["kind"], r["name"], msg))
+		}
+	}
+	synced, _, _ := unstructured.NestedSlice(obj.Object, "status", "operationState", "syncResult", "resources")
+	for _, item := range synced {
+		r, _ := item.(map[string]interface{})
+		if status, _ := r["status"].(string); status == "SyncFailed" {
+			msg, _ := r["message"].(string)
+			add(r, msg)
+		}
+	}
+	resources, _, _ := unstructured.NestedSlice(obj.Object, "status", "resources")
+	for _, item := range resources {
+		r, _ := item.(map[string]interface{})
+		health, _ := r["health"].(map[string]interface{})
+		if status, _ := health["status"].(string); status == "Degraded" || status == "Missing" {
+			msg, _ := health["message"].(string)
+			add(r, firstNonEmpty(msg, status))
+		}
+	}
+	return out
+}
+
+// StatusCurrent reports whether the status of a live Application describes
+// its current spec. Right after an apply the status may still hold the result
+// for the previous spec; it is current once Argo CD reconciled the application
+// after since, or compared the source and destination the spec now has.
+func StatusCurrent(obj *unstructured.Unstructured, since time.Time) bool {
+	reconciledAt, _, _ := unstructured.NestedString(obj.Object, "status", "reconciledAt")
+	// reconciledAt has second precision
+	if t, err := time.Parse(time.RFC3339, reconciledAt); err == nil && t.After(since.Truncate(time.Second)) {
+		return true
+	}
+	compared, ok, _ := unstructured.NestedMap(obj.Object, "status", "sync", "comparedTo")
+	if !ok {
+		return false
+	}
+	for _, field := range []string{"source", "sources", "destination"} {
+		want, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", field)
+		if !reflect.DeepEqual(compared[field], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready reports whether the application is synced and healthy
+func (s AppStatus) Ready() bool {
+	return s.Sync == "Synced" && s.Health == "Healthy"
+}
+
+// Failed reports whether the application reached a state it will not recover
+// from without intervention
+func (s AppStatus) Failed() bool {
+	return s.Health == "Degraded" || s.Phase == "Failed" || s.Phase == "Error"
+}
+
+func (s AppStatus) String() string {
+	out := fmt.Sprintf("sync=%s health=%s", orUnknown(s.Sync), orUnknown(s.Health))
+	if s.Phase != "" {
+		out += " operation=" + s.Phase
+	}
+	return out
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "Unknown"
+	}
+	return s
+}
+
+// ApplicationSetStatus summarises a live ApplicationSet and the applications
+// it generated
+type ApplicationSetStatus struct {
+	Name         string   `json:"name"`
+	Project      string   `json:"project"`
+	Generators   []string `json:"generators"`
+	Applications int      `json:"applications"`
+	// UpToDate is the status of the ResourcesUpToDate condition
+	UpToDate string `json:"upToDate"`
+	Message  string `json:"message"`
+}
+
+// ApplicationSetSummary reads the spec and conditions of a live ApplicationSet
+func ApplicationSetSummary(obj *unstructured.Unstructured) ApplicationSetStatus {
+	s := ApplicationSetStatus{Name: obj.GetName(), Generators: []string{}}
+	s.Project, _, _ = unstructured.NestedString(obj.Object, "spec", "template", "spec", "project")
+	generators, _, _ := unstructured.NestedSlice(obj.Object, "spec", "generators")
+	for _, g := range generators {
+		if m, ok := g.(map[string]interface{}); ok {
+			for kind := range m {
+				s.Generators = append(s.Generators, kind)
+			}
+		}
+	}
+	sort.Strings(s.Generators)
+	resources, _, _ := unstructured.NestedSlice(obj.Object, "status", "resources")
+	s.Applications = len(resources)
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, _ := c.(map[string]interface{})
+		status, _ := m["status"].(string)
+		switch m["type"] {
+		case "ResourcesUpToDate":
+			s.UpToDate = status
+		case "ErrorOccurred":
+			if status == "True" {
+				s.Message, _ = m["message"].(string)
+			}
+		}
+	}
+	return s
+}
+
+// ProjectStatus summarises a live AppProject
+type ProjectStatus struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	SourceRepos []string `json:"sourceRepos"`
+}
+
+// ProjectSummary reads the spec of a live AppProject
+func ProjectSummary(obj *unstructured.Unstructured) ProjectStatus {
+	desc, _, _ := unstructured.NestedString(obj.Object, "spec", "description")
+	repos, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "sourceRepos")
+	return ProjectStatus{Name: obj.GetName(), Description: desc, SourceRepos: repos}
+}
+
+// SecretStatus summarises a live Argo CD secret without its credentials
+type SecretStatus struct {
+	Name       string `json:"name"`
+	SecretType string `json:"secretType"`
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+}
+
+// SecretSummary reads the non-sensitive keys of a live Argo CD secret
+func SecretSummary(obj *unstructured.Unstructured) SecretStatus {
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	decode := func(key string) string {
+		b, err := base64.StdEncoding.DecodeString(data[key])
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return SecretStatus{
+		Name:       obj.GetName(),
+		SecretType: obj.GetLabels()[SecretTypeLabel],
+		Type:       decode("type"),
+		// cluster secrets carry the API server instead of a repository URL
+		URL: firstNonEmpty(decode("url"), decode("server")),
+	}
+}
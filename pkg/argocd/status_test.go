@@ -0,0 +1,94 @@
+package argocd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func liveApplication(t *testing.T, doc string) *unstructured.Unstructured {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &m); err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: m}
+}
+
+func TestStatusCurrent(t *testing.T) {
+	applied := time.Date(2026, 1, 2, 10, 0, 0, 500e6, time.UTC)
+	tests := []struct {
+		name string
+		doc  string
+		want bool
+	}{
+		{
+			name: "reconciled after apply",
+			doc: `{"spec": {"source": {"path": "new"}}, "status": {"reconciledAt": "2026-01-02T10:00:01Z",
+				"sync": {"comparedTo": {"source": {"path": "old"}}}}}`,
+			want: true,
+		},
+		{
+			name: "stale status of the previous source",
+			doc: `{"spec": {"source": {"path": "new"}}, "status": {"reconciledAt": "2026-01-02T09:59:00Z",
+				"sync": {"status": "Synced", "comparedTo": {"source": {"path": "old"}}}}}`,
+			want: false,
+		},
+		{
+			name: "reconciled in the second of the apply",
+			doc: `{"spec": {"source": {"path": "new"}}, "status": {"reconciledAt": "2026-01-02T10:00:00Z",
+				"sync": {"comparedTo": {"source": {"path": "old"}}}}}`,
+			want: false,
+		},
+		{
+			name: "compared to the current source and destination",
+			doc: `{"spec": {"source": {"path": "new"}, "destination": {"namespace": "a"}}, "status": {"reconciledAt": "2026-01-02T09:59:00Z",
+				"sync": {"comparedTo": {"source": {"path": "new"}, "destination": {"namespace": "a"}}}}}`,
+			want: true,
+		},
+		{
+			name: "compared to another destination",
+			doc: `{"spec": {"source": {"path": "new"}, "destination": {"namespace": "b"}},
+				"status": {"sync": {"comparedTo": {"source": {"path": "new"}, "destination": {"namespace": "a"}}}}}`,
+			want: false,
+		},
+		{
+			name: "never reconciled",
+			doc:  `{"spec": {"source": {"path": "new"}}}`,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusCurrent(liveApplication(t, tt.doc), applied); got != tt.want {
+				t.Errorf("StatusCurrent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplicationStatusResources(t *testing.T) {
+	obj := liveApplication(t, `{"status": {
+		"health": {"status": "Degraded"},
+		"operationState": {"phase": "Failed", "message": "one or more objects failed to apply",
+			"syncResult": {"resources": [
+				{"kind": "ConfigMap", "name": "ok", "status": "Synced", "message": "configured"},
+				{"kind": "Deployment", "name": "web", "status": "SyncFailed", "message": "field is immutable"}
+			]}},
+		"resources": [
+			{"kind": "Service", "name": "web", "health": {"status": "Healthy"}},
+			{"kind": "StatefulSet", "name": "db", "health": {"status": "Degraded", "message": "0/1 replicas ready"}},
+			{"kind": "Secret", "name": "creds", "health": {"status": "Missing"}}
+		]}}`)
+	want := []string{
+		"Deployment/web: field is immutable",
+		"StatefulSet/db: 0/1 replicas ready",
+		"Secret/creds: Missing",
+	}
+	if got := ApplicationStatus(obj).Resources; !reflect.DeepEqual(got, want) {
+		t.Errorf("Resources = %q, want %q", got, want)
+	}
+}
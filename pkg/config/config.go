@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"strings"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
+	"sigs.k8s.io/yaml"
 )
 
 // Example YAML:
@@ -15,6 +20,19 @@ import (
 ////     destinations:
 //       - namespace: default
 //         server: https://kubernetes.default.svc
+//     clusterResourceWhitelist:
+//       - group: ""
+//         kind: Namespace
+//     roles:
+//       - name: deployer
+//         policies:
+//           - p, proj:demo-proj:deployer, applications, sync, demo-proj/*, allow
+//         groups: [my-org:deployers]
+//     syncWindows:
+//       - kind: deny
+//         schedule: "0 22 * * *"
+//         duration: 8h
+//         applications: ["*"]
 // applications:
 //   - name: demo-app
 //     project: demo-proj
@@ -22,7 +40,17 @@ import (
 //     sourcePath: manifests/app
 //     destinationNamespace: default
 //     destinationServer: https://kubernetes.default.svc
-//     syncPolicy: automated
+//     syncPolicy:
+//       mode: automated
+//       prune: true
+//       selfHeal: true
+//       syncOptions: [CreateNamespace=true, ServerSideApply=true]
+//       retry:
+//         limit: 5
+//         backoff:
+//           duration: 5s
+//           factor: 2
+//           maxDuration: 3m
 //     isHelm: true
 //     isOCI: true
 //     ociRepoURL: https://ghcr.io/zcubbs/demo-chart
@@ -30,10 +58,101 @@ import (
 //     ociChartVersion: 1.0.0
 //     helmValueFiles:
 //       - values.yaml
+//     helm:
+//       releaseName: demo
+//       valuesObject:
+//         replicaCount: 2
+//       parameters:
+//         - name: image.tag
+//           value: "1.2.3"
+//           forceString: true
 //     targetRevision: main
 //     valuesRepoURL: https://github.com/zcubbs/values
 //     valuesPath: manifests/values
 //     valuesTargetRevision: main
+//   - name: demo-multi
+//     project: demo-proj
+//     destinationServer: https://kubernetes.default.svc
+//     sources:
+//       - type: oci
+//         repoURL: ghcr.io/zcubbs/charts
+//         chart: demo-chart
+//         targetRevision: 1.0.0
+//         helmValueFiles: [$base/values.yaml, $env/prod.yaml]
+//       - repoURL: https://github.com/zcubbs/values
+//         ref: base
+//       - repoURL: https://github.com/zcubbs/env-values
+//         ref: env
+//   - name: demo-kustomize
+//     project: demo-proj
+//     sourceRepoURL: https://github.com/zcubbs/hotpot
+//     sourcePath: overlays/prod
+//     destinationServer: https://kubernetes.default.svc
+//     kustomize:
+//       namePrefix: prod-
+//       images: [nginx=nginx:1.27]
+//       commonLabels:
+//         team: platform
+//   - name: demo-jsonnet
+//     project: demo-proj
+//     sourceRepoURL: https://github.com/zcubbs/hotpot
+//     sourcePath: jsonnet
+//     destinationServer: https://kubernetes.default.svc
+//     directory:
+//       recurse: true
+//       jsonnet:
+//         tlas:
+//           - name: env
+//             value: prod
+//   - name: demo-sops
+//     project: demo-proj
+//     sourceRepoURL: https://github.com/zcubbs/hotpot
+//     sourcePath: secrets
+//     destinationServer: https://kubernetes.default.svc
+//     plugin:
+//       name: sops
+//       env:
+//         - name: SOPS_AGE_KEY_FILE
+//           value: /keys/age.txt
+// targets:
+//   - name: eu
+//     context: prod-eu
+//   - name: us
+//     context: prod-us
+//     namespace: argocd
+// apiRetry:
+//   maxAttempts: 5
+//   backoff: 500ms
+//   maxBackoff: 30s
+// argocd:
+//   server: https://argocd.example.com
+//   authToken: ${ARGOCD_AUTH_TOKEN}
+// clusters:
+//   - name: prod-eu
+//     server: https://prod-eu.example.com
+//     namespaces: [apps, monitoring]
+//     labels:
+//       env: prod
+//     config:
+//       bearerToken: ${PROD_EU_TOKEN}
+//       tlsClientConfig:
+//         caData: ${PROD_EU_CA}
+// applicationSets:
+//   - name: demo-envs
+//     generators:
+//       - list:
+//           elements:
+//             - env: dev
+//             - env: prod
+//     template:
+//       name: "demo-{{env}}"
+//       project: demo-proj
+//       sourceRepoURL: https://github.com/zcubbs/hotpot
+//       sourcePath: "envs/{{env}}"
+//       destinationNamespace: "demo-{{env}}"
+//       destinationServer: https://kubernetes.default.svc
+//     syncPolicy:
+//       preserveResourcesOnDeletion: true
 // repositories:
 //   - url: https://github.com/zcubbs/go-k8s
 //     type: git
@@ -42,6 +161,7 @@ import (
 //   - url: https://github.com
 //     username: ${GIT_USERNAME}
 //     password: ${GIT_PASSWORD}
+//     type: git
 //     name: demo-cred
 
 type Config struct {
@@ -49,58 +169,512 @@ type Config struct {
 	Applications []Application `mapstructure:"applications"`
 	Repositories []Repository  `mapstructure:"repositories"`
 	Credentials  []Credential  `mapstructure:"credentials"`
+	Clusters     []Cluster     `mapstructure:"clusters"`
+	// ApplicationSets template applications over generated parameters
+	ApplicationSets []ApplicationSet `mapstructure:"applicationSets"`
+	// ArgoCD is the API server used by commands that go through Argo CD
+	// instead of the Kubernetes API, such as project tokens
+	ArgoCD *ArgoCDServer `mapstructure:"argocd"`
+	// Targets are the Argo CD instances apply fans out to. Without targets
+	// rgo uses the cluster selected by the connection flags.
+	Targets []Target `mapstructure:"targets"`
+	// APIRetry retries Kubernetes API calls that fail for transient reasons;
+	// the --retry-* flags override it
+	APIRetry *APIRetry `mapstructure:"apiRetry"`
+}
+
+// APIRetry configures retries of conflicts, throttling, timeouts and
+// unavailable webhooks. Durations use Go syntax, e.g. 500ms.
+type APIRetry struct {
+	MaxAttempts int     `mapstructure:"maxAttempts"` // including the first, 1 disables retries
+	Backoff     string  `mapstructure:"backoff"`     // first delay, doubled on each retry
+	MaxBackoff  string  `mapstructure:"maxBackoff"`
+	Jitter      float64 `mapstructure:"jitter"` // random extra delay, as a fraction of the delay
+}
+
+// Target is one Argo CD instance, reached through a kubeconfig context
+type Target struct {
+	Name       string `mapstructure:"name" jsonschema:"required"`
+	Kubeconfig string `mapstructure:"kubeconfig"` // default: --kubeconfig
+	Context    string `mapstructure:"context"`    // default: --context
+	Namespace  string `mapstructure:"namespace"`  // Argo CD namespace, default: --namespace
+}
+
+// ArgoCDServer locates and authenticates to the Argo CD API server. Values may
+// use ${ENV} placeholders; ARGOCD_SERVER and ARGOCD_AUTH_TOKEN override them.
+type ArgoCDServer struct {
+	Server    string `mapstructure:"server" jsonschema:"required"` // base URL, e.g. https://argocd.example.com
+	AuthToken string `mapstructure:"authToken"`
+	// Username and Password open a session when no authToken is set
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Insecure bool   `mapstructure:"insecure"` // skip TLS verification
 }
 
 type Project struct {
-	Name         string        `mapstructure:"name"`
+	Name         string        `mapstructure:"name" jsonschema:"required"`
 	Description  string        `mapstructure:"description"`
 	SourceRepos  []string      `mapstructure:"sourceRepos"`
 	Destinations []Destination `mapstructure:"destinations"`
+	// SourceNamespaces lets Applications outside the Argo CD namespace use the project
+	SourceNamespaces           []string           `mapstructure:"sourceNamespaces"`
+	ClusterResourceWhitelist   []GroupKind        `mapstructure:"clusterResourceWhitelist"`
+	ClusterResourceBlacklist   []GroupKind        `mapstructure:"clusterResourceBlacklist"`
+	NamespaceResourceWhitelist []GroupKind        `mapstructure:"namespaceResourceWhitelist"`
+	NamespaceResourceBlacklist []GroupKind        `mapstructure:"namespaceResourceBlacklist"`
+	OrphanedResources          *OrphanedResources `mapstructure:"orphanedResources"`
+	SignatureKeys              []string           `mapstructure:"signatureKeys"` // GnuPG key IDs commits must be signed with
+	Roles                      []ProjectRole      `mapstructure:"roles"`
+	SyncWindows                []SyncWindow       `mapstructure:"syncWindows"`
+	Targets                    []string           `mapstructure:"targets"` // target names; empty means every target
 }
 
+// Destination is a cluster, by server URL or by name, and namespace
+// applications of a project may deploy to
 type Destination struct {
 	Namespace string `mapstructure:"namespace"`
 	Server    string `mapstructure:"server"`
+	Name      string `mapstructure:"name"`
+}
+
+// GroupKind matches resources by API group and kind; "*" matches any
+type GroupKind struct {
+	Group string `mapstructure:"group"`
+	Kind  string `mapstructure:"kind" jsonschema:"required"`
+}
+
+// OrphanedResources enables monitoring of resources in destination namespaces
+// that no application of the project manages
+type OrphanedResources struct {
+	Warn   bool                  `mapstructure:"warn"`
+	Ignore []OrphanedResourceKey `mapstructure:"ignore"`
+}
+
+type OrphanedResourceKey struct {
+	Group string `mapstructure:"group"`
+	Kind  string `mapstructure:"kind"`
+	Name  string `mapstructure:"name"`
+}
+
+// ProjectRole grants the policies to the SSO groups and to tokens issued for the role
+type ProjectRole struct {
+	Name        string `mapstructure:"name" jsonschema:"required"`
+	Description string `mapstructure:"description"`
+	// Policies are Casbin lines such as
+	// "p, proj:my-project:deployer, applications, sync, my-project/*, allow"
+	Policies []string `mapstructure:"policies"`
+	Groups   []string `mapstructure:"groups"`
+}
+
+// SyncWindow allows or denies syncs of the matching applications for
+// duration after each cron schedule
+type SyncWindow struct {
+	Kind         string   `mapstructure:"kind" jsonschema:"required,enum=allow|deny"`
+	Schedule     string   `mapstructure:"schedule" jsonschema:"required"`
+	Duration     string   `mapstructure:"duration" jsonschema:"required"`
+	Applications []string `mapstructure:"applications"`
+	Namespaces   []string `mapstructure:"namespaces"`
+	Clusters     []string `mapstructure:"clusters"`
+	ManualSync   bool     `mapstructure:"manualSync"`
+	TimeZone     string   `mapstructure:"timeZone"`
 }
 
 type Application struct {
-	Name                 string   `mapstructure:"name"`
-	Project              string   `mapstructure:"project"`
-	DestinationNamespace string   `mapstructure:"destinationNamespace"`
-	DestinationServer    string   `mapstructure:"destinationServer"`
-	SourceRepoURL        string   `mapstructure:"sourceRepoURL"`
-	SourcePath           string   `mapstructure:"sourcePath"`
-	TargetRevision       string   `mapstructure:"targetRevision"`
-	SyncPolicy           string   `mapstructure:"syncPolicy"`
-	IsHelm               bool     `mapstructure:"isHelm"`
-	IsOCI                bool     `mapstructure:"isOCI"`
-	OCIRepoURL           string   `mapstructure:"ociRepoURL"`
-	OCIChartName         string   `mapstructure:"ociChartName"`
-	OCIChartVersion      string   `mapstructure:"ociChartVersion"`
-	HelmValueFiles       []string `mapstructure:"helmValueFiles"`
+	Name                 string     `mapstructure:"name" jsonschema:"required"`
+	Project              string     `mapstructure:"project" jsonschema:"required"`
+	DestinationNamespace string     `mapstructure:"destinationNamespace"`
+	DestinationServer    string     `mapstructure:"destinationServer" jsonschema:"required"`
+	SourceRepoURL        string     `mapstructure:"sourceRepoURL"`
+	SourcePath           string     `mapstructure:"sourcePath"`
+	TargetRevision       string     `mapstructure:"targetRevision"`
+	SyncPolicy           SyncPolicy `mapstructure:"syncPolicy"`
+	IsHelm               bool       `mapstructure:"isHelm"`
+	IsOCI                bool       `mapstructure:"isOCI"`
+	OCIRepoURL           string     `mapstructure:"ociRepoURL"`
+	OCIChartName         string     `mapstructure:"ociChartName"`
+	OCIChartVersion      string     `mapstructure:"ociChartVersion"`
+	HelmValueFiles       []string   `mapstructure:"helmValueFiles"`
+	Kustomize            *Kustomize `mapstructure:"kustomize"`
+	Helm                 *Helm      `mapstructure:"helm"` // implies isHelm
+	Directory            *Directory `mapstructure:"directory"`
+	Plugin               *Plugin    `mapstructure:"plugin"`
+	// Values* locate the `ref: values` source of OCI charts, defaulting to the source repo
+	ValuesRepoURL        string `mapstructure:"valuesRepoURL"`
+	ValuesPath           string `mapstructure:"valuesPath"`
+	ValuesTargetRevision string `mapstructure:"valuesTargetRevision"`
+	// Sources replaces the single source fields with any number of sources
+	Sources []Source `mapstructure:"sources"`
+	Targets []string `mapstructure:"targets"` // target names; empty means every target
+}
+
+// Source is one source of a multi-source application. Sources with a Ref can
+// be referenced from helm value files of other sources as $ref/path.
+type Source struct {
+	Type           string     `mapstructure:"type" jsonschema:"enum=git|helm|oci|kustomize"` // inferred when empty
+	RepoURL        string     `mapstructure:"repoURL" jsonschema:"required"`
+	Path           string     `mapstructure:"path"`
+	Chart          string     `mapstructure:"chart"`
+	TargetRevision string     `mapstructure:"targetRevision"`
+	Ref            string     `mapstructure:"ref"`
+	HelmValueFiles []string   `mapstructure:"helmValueFiles"`
+	Helm           *Helm      `mapstructure:"helm"`
+	Kustomize      *Kustomize `mapstructure:"kustomize"`
+	Directory      *Directory `mapstructure:"directory"`
+	Plugin         *Plugin    `mapstructure:"plugin"`
+}
+
+const (
+	SourceTypeGit       = "git"
+	SourceTypeHelm      = "helm"
+	SourceTypeOCI       = "oci"
+	SourceTypeKustomize = "kustomize"
+)
+
+// SourceType returns the declared type, or the one implied by the other fields
+func (s Source) SourceType() string {
+	switch {
+	case s.Type != "":
+		return s.Type
+	case s.Kustomize != nil:
+		return SourceTypeKustomize
+	case strings.HasPrefix(s.RepoURL, "oci://"):
+		return SourceTypeOCI
+	case s.Chart != "" || s.Helm != nil:
+		return SourceTypeHelm
+	default:
+		return SourceTypeGit
+	}
+}
+
+// HelmSource reports whether the single source of the application is a Helm chart
+func (a Application) HelmSource() bool {
+	return a.IsHelm || a.Helm != nil
+}
+
+// Helm holds the Helm rendering options of a chart source
+type Helm struct {
+	ValueFiles              []string               `mapstructure:"valueFiles"` // appended to helmValueFiles
+	Values                  string                 `mapstructure:"values"`
+	ValuesObject            map[string]interface{} `mapstructure:"valuesObject"`
+	Parameters              []HelmParameter        `mapstructure:"parameters"`
+	FileParameters          []HelmFileParameter    `mapstructure:"fileParameters"`
+	ReleaseName             string                 `mapstructure:"releaseName"`
+	SkipCrds                bool                   `mapstructure:"skipCrds"`
+	IgnoreMissingValueFiles bool                   `mapstructure:"ignoreMissingValueFiles"`
+	Version                 string                 `mapstructure:"version" jsonschema:"enum=v2|v3"`
+	PassCredentials         *bool                  `mapstructure:"passCredentials"` // defaults to true
+}
+
+type HelmParameter struct {
+	Name        string `mapstructure:"name" jsonschema:"required"`
+	Value       string `mapstructure:"value"`
+	ForceString bool   `mapstructure:"forceString"`
+}
+
+type HelmFileParameter struct {
+	Name string `mapstructure:"name" jsonschema:"required"`
+	Path string `mapstructure:"path" jsonschema:"required"`
+}
+
+// Directory controls how plain manifest and jsonnet directories are read
+type Directory struct {
+	Recurse bool     `mapstructure:"recurse"`
+	Include string   `mapstructure:"include"` // glob, e.g. "{*.yaml,*.yml}"
+	Exclude string   `mapstructure:"exclude"`
+	Jsonnet *Jsonnet `mapstructure:"jsonnet"`
+}
+
+type Jsonnet struct {
+	TLAs    []JsonnetVar `mapstructure:"tlas"`
+	ExtVars []JsonnetVar `mapstructure:"extVars"`
+	Libs    []string     `mapstructure:"libs"`
+}
+
+// JsonnetVar is a top-level argument or external variable; Code evaluates Value as jsonnet
+type JsonnetVar struct {
+	Name  string `mapstructure:"name" jsonschema:"required"`
+	Value string `mapstructure:"value"`
+	Code  bool   `mapstructure:"code"`
+}
+
+// Plugin renders the source with a Config Management Plugin
+type Plugin struct {
+	Name       string            `mapstructure:"name"` // optional with plugin discovery
+	Env        []PluginEnv       `mapstructure:"env"`
+	Parameters []PluginParameter `mapstructure:"parameters"`
+}
+
+type PluginEnv struct {
+	Name  string `mapstructure:"name" jsonschema:"required"`
+	Value string `mapstructure:"value"`
+}
+
+// PluginParameter sets exactly one of String, Array or Map
+type PluginParameter struct {
+	Name   string            `mapstructure:"name" jsonschema:"required"`
+	String string            `mapstructure:"string"`
+	Array  []string          `mapstructure:"array"`
+	Map    map[string]string `mapstructure:"map"`
+}
+
+// Kustomize renders the source path with kustomize and the given overrides
+type Kustomize struct {
+	NamePrefix        string             `mapstructure:"namePrefix"`
+	NameSuffix        string             `mapstructure:"nameSuffix"`
+	Images            []string           `mapstructure:"images"` // e.g. nginx=nginx:1.27 or nginx:1.27
+	CommonLabels      map[string]string  `mapstructure:"commonLabels"`
+	CommonAnnotations map[string]string  `mapstructure:"commonAnnotations"`
+	Namespace         string             `mapstructure:"namespace"`
+	Replicas          []KustomizeReplica `mapstructure:"replicas"`
+	Patches           []KustomizePatch   `mapstructure:"patches"`
+	Version           string             `mapstructure:"version"`
+}
+
+type KustomizeReplica struct {
+	Name  string `mapstructure:"name" jsonschema:"required"`
+	Count int64  `mapstructure:"count"`
+}
+
+// KustomizePatch is an inline patch or a patch file, optionally restricted to a target
+type KustomizePatch struct {
+	Patch   string           `mapstructure:"patch"`
+	Path    string           `mapstructure:"path"`
+	Target  *KustomizeTarget `mapstructure:"target"`
+	Options map[string]bool  `mapstructure:"options"`
+}
+
+type KustomizeTarget struct {
+	Group              string `mapstructure:"group"`
+	Version            string `mapstructure:"version"`
+	Kind               string `mapstructure:"kind"`
+	Name               string `mapstructure:"name"`
+	Namespace          string `mapstructure:"namespace"`
+	LabelSelector      string `mapstructure:"labelSelector"`
+	AnnotationSelector string `mapstructure:"annotationSelector"`
+}
+
+// SyncPolicy controls how Argo CD syncs an application. It may also be given
+// as a plain string ("automated" or "manual"), which only sets Mode.
+type SyncPolicy struct {
+	Mode        string   `mapstructure:"mode" jsonschema:"enum=automated|manual"` // defaults to automated
+	Prune       *bool    `mapstructure:"prune"`
+	SelfHeal    *bool    `mapstructure:"selfHeal"`
+	AllowEmpty  bool     `mapstructure:"allowEmpty"`
+	SyncOptions []string `mapstructure:"syncOptions"`
+	Retry       *Retry   `mapstructure:"retry"`
+}
+
+const (
+	SyncModeAutomated = "automated"
+	SyncModeManual    = "manual"
+)
+
+// Automated reports whether the policy enables automated sync.
+func (p SyncPolicy) Automated() bool {
+	return p.Mode == "" || p.Mode == SyncModeAutomated
+}
+
+type Retry struct {
+	Limit   int64    `mapstructure:"limit"`
+	Backoff *Backoff `mapstructure:"backoff"`
+}
+
+type Backoff struct {
+	Duration    string `mapstructure:"duration"`
+	Factor      int64  `mapstructure:"factor"`
+	MaxDuration string `mapstructure:"maxDuration"`
+}
+
+// Cluster registers a destination cluster with Argo CD. String values may use
+// ${ENV} placeholders.
+type Cluster struct {
+	Name             string            `mapstructure:"name" jsonschema:"required"`
+	Server           string            `mapstructure:"server" jsonschema:"required"`
+	Namespaces       []string          `mapstructure:"namespaces"` // restricts Argo CD to these namespaces
+	ClusterResources bool              `mapstructure:"clusterResources"`
+	Project          string            `mapstructure:"project"`
+	Labels           map[string]string `mapstructure:"labels"`
+	Annotations      map[string]string `mapstructure:"annotations"`
+	Config           ClusterConfig     `mapstructure:"config"`
+	Targets          []string          `mapstructure:"targets"` // target names; empty means every target
+}
+
+// ClusterConfig holds how Argo CD authenticates to the cluster; set one auth method
+type ClusterConfig struct {
+	BearerToken        string              `mapstructure:"bearerToken"`
+	Username           string              `mapstructure:"username"`
+	Password           string              `mapstructure:"password"`
+	TLSClientConfig    *TLSClientConfig    `mapstructure:"tlsClientConfig"`
+	ExecProviderConfig *ExecProviderConfig `mapstructure:"execProviderConfig"`
+	AWSAuthConfig      *AWSAuthConfig      `mapstructure:"awsAuthConfig"`
+	// GCPAuth authenticates with the workload identity of the Argo CD pods on GKE
+	GCPAuth bool `mapstructure:"gcpAuth"`
+}
+
+type TLSClientConfig struct {
+	Insecure   bool   `mapstructure:"insecure"`
+	ServerName string `mapstructure:"serverName"`
+	CAData     string `mapstructure:"caData"` // base64 PEM, as in kubeconfig
+	CertData   string `mapstructure:"certData"`
+	KeyData    string `mapstructure:"keyData"`
+}
+
+type ExecProviderConfig struct {
+	Command     string            `mapstructure:"command" jsonschema:"required"`
+	Args        []string          `mapstructure:"args"`
+	Env         map[string]string `mapstructure:"env"`
+	APIVersion  string            `mapstructure:"apiVersion"`
+	InstallHint string            `mapstructure:"installHint"`
+}
+
+type AWSAuthConfig struct {
+	ClusterName string `mapstructure:"clusterName" jsonschema:"required"`
+	RoleARN     string `mapstructure:"roleARN"`
+	Profile     string `mapstructure:"profile"`
+}
+
+// ApplicationSet generates one application per parameter set produced by its
+// generators. Template fields may use {{param}} placeholders.
+type ApplicationSet struct {
+	Name              string                    `mapstructure:"name" jsonschema:"required"`
+	Generators        []Generator               `mapstructure:"generators" jsonschema:"required"`
+	Template          Application               `mapstructure:"template" jsonschema:"required"`
+	GoTemplate        bool                      `mapstructure:"goTemplate"`
+	GoTemplateOptions []string                  `mapstructure:"goTemplateOptions"`
+	SyncPolicy        *ApplicationSetSyncPolicy `mapstructure:"syncPolicy"`
+	Targets           []string                  `mapstructure:"targets"` // target names; empty means every target
+}
+
+type ApplicationSetSyncPolicy struct {
+	// PreserveResourcesOnDeletion keeps generated applications' resources when the set is deleted
+	PreserveResourcesOnDeletion bool   `mapstructure:"preserveResourcesOnDeletion"`
+	ApplicationsSync            string `mapstructure:"applicationsSync" jsonschema:"enum=create-only|create-update|create-delete|sync"`
+}
+
+// Generator sets exactly one generator type
+type Generator struct {
+	List     *ListGenerator     `mapstructure:"list"`
+	Clusters *ClustersGenerator `mapstructure:"clusters"`
+	Git      *GitGenerator      `mapstructure:"git"`
+	Matrix   *MatrixGenerator   `mapstructure:"matrix"`
+}
+
+type ListGenerator struct {
+	Elements []map[string]interface{} `mapstructure:"elements" jsonschema:"required"`
+}
+
+// ClustersGenerator yields the clusters registered in Argo CD matching Selector
+type ClustersGenerator struct {
+	Selector map[string]string `mapstructure:"selector"` // matchLabels
+	Values   map[string]string `mapstructure:"values"`
+}
+
+// GitGenerator yields directories or parsed files from a Git repository
+type GitGenerator struct {
+	RepoURL     string         `mapstructure:"repoURL" jsonschema:"required"`
+	Revision    string         `mapstructure:"revision"`
+	Directories []GitDirectory `mapstructure:"directories"`
+	Files       []GitFile      `mapstructure:"files"`
+}
+
+type GitDirectory struct {
+	Path    string `mapstructure:"path" jsonschema:"required"`
+	Exclude bool   `mapstructure:"exclude"`
+}
+
+type GitFile struct {
+	Path string `mapstructure:"path" jsonschema:"required"`
+}
+
+// MatrixGenerator combines the parameters of two child generators
+type MatrixGenerator struct {
+	Generators []Generator `mapstructure:"generators" jsonschema:"required"`
 }
 
 type Repository struct {
-	URL      string `mapstructure:"url"`
-	Type     string `mapstructure:"type"`
-	Name     string `mapstructure:"name"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
-	SSHKey   string `mapstructure:"sshKey"`
+	URL      string   `mapstructure:"url" jsonschema:"required"`
+	Type     string   `mapstructure:"type" jsonschema:"enum=git|helm|oci"`
+	Name     string   `mapstructure:"name"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	SSHKey   string   `mapstructure:"sshKey"`
+	Targets  []string `mapstructure:"targets"` // target names; empty means every target
 }
 
+// Credential is a credential template applied to every repository whose URL
+// starts with URL.
 type Credential struct {
-	URL      string `mapstructure:"url"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
-	SSHKey   string `mapstructure:"sshKey"`
-	Name     string `mapstructure:"name"`
+	URL      string   `mapstructure:"url" jsonschema:"required"`
+	Type     string   `mapstructure:"type" jsonschema:"enum=git|helm|oci"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	SSHKey   string   `mapstructure:"sshKey"`
+	Name     string   `mapstructure:"name"`
+	Targets  []string `mapstructure:"targets"` // target names; empty means every target
 }
 
+// Load decodes the config file found by viper. Keys are matched exactly and
+// unknown keys are rejected, so typos surface before anything is applied.
+// Environment variables do not override config keys; values refer to them
+// with ${VAR} placeholders.
 func Load() (Config, error) {
 	var c Config
-	if err := viper.Unmarshal(&c); err != nil {
-		return c, fmt.Errorf("config unmarshal: %w", err)
+	raw, err := readRaw()
+	if err != nil {
+		return c, err
+	}
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHook(),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		MatchName:        func(mapKey, fieldName string) bool { return mapKey == fieldName },
+		Result:           &c,
+	})
+	if err != nil {
+		return c, err
+	}
+	if err := dec.Decode(raw); err != nil {
+		return c, decodeErrors(err)
 	}
 	return c, nil
 }
+
+// readRaw reads the config file as-is: viper lower-cases every key, which
+// would hide misspelled keys and mangle map keys such as labels. Without a
+// config file the config is empty; viper's own settings hold the bound
+// command line flags, which are not config keys.
+func readRaw() (map[string]interface{}, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return map[string]interface{}{}, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config read: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("config parse: %w", err)
+	}
+	return raw, nil
+}
+
+// decodeHook extends viper's default hooks with the shorthand forms accepted
+// in the config file.
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		stringToSyncPolicyHookFunc(),
+	)
+}
+
+// stringToSyncPolicyHookFunc accepts the legacy `syncPolicy: automated` form.
+func stringToSyncPolicyHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != reflect.TypeOf(SyncPolicy{}) {
+			return data, nil
+		}
+		return map[string]interface{}{"mode": data}, nil
+	}
+}
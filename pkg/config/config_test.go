@@ -0,0 +1,99 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Connection flags are bound to viper; without a config file they must not be
+// mistaken for config keys.
+func TestLoadWithoutConfigFileIgnoresBoundFlags(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	flags := pflag.NewFlagSet("rgo", pflag.ContinueOnError)
+	flags.String("kubeconfig", "", "")
+	flags.Int("burst", 0, "")
+	if err := flags.Parse([]string{"--kubeconfig=/tmp/kc", "--burst=10"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"kubeconfig", "burst"} {
+		if err := viper.BindPFlag(name, flags.Lookup(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("RGO_CONTEXT", "prod")
+	viper.SetEnvPrefix("RGO")
+	viper.AutomaticEnv()
+	viper.SetDefault("context", "")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateClusterReservedKeys(t *testing.T) {
+	c := Config{Clusters: []Cluster{{
+		Name:        "prod",
+		Server:      "https://prod.example.com",
+		Labels:      map[string]string{"env": "prod", "managed-by": "me", "argocd.argoproj.io/secret-type": "repository"},
+		Annotations: map[string]string{"rgo/content-hash": "x"},
+	}}}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("want errors for reserved keys")
+	}
+	for _, want := range []string{
+		`clusters[0].labels: "argocd.argoproj.io/secret-type" is reserved for rgo`,
+		`clusters[0].labels: "managed-by" is reserved for rgo`,
+		`clusters[0].annotations: "rgo/content-hash" is reserved for rgo`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors %q do not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `"env"`) {
+		t.Errorf("user label reported: %v", err)
+	}
+}
+
+func TestValidateDefaultProject(t *testing.T) {
+	c := Config{Projects: []Project{{Name: "default", SourceRepos: []string{"*"}}}}
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), `projects[0].name: "default" is the built-in Argo CD project`) {
+		t.Fatalf("err = %v, want the default project rejected", err)
+	}
+}
+
+func TestValidateManualSyncOptions(t *testing.T) {
+	prune := false
+	c := Config{Applications: []Application{{
+		Name:              "web",
+		Project:           "default",
+		DestinationServer: "https://kubernetes.default.svc",
+		SourceRepoURL:     "https://github.com/x/y.git",
+		SyncPolicy:        SyncPolicy{Mode: SyncModeManual, Prune: &prune, AllowEmpty: true, SyncOptions: []string{"CreateNamespace"}},
+	}}}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("want errors for automated sync options")
+	}
+	for _, want := range []string{
+		`applications[0].syncPolicy.prune: has no effect with mode "manual"`,
+		`applications[0].syncPolicy.allowEmpty: has no effect with mode "manual"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors %q do not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "selfHeal") || strings.Contains(err.Error(), "syncOptions") {
+		t.Errorf("unset or valid options reported: %v", err)
+	}
+}
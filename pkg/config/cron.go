@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cronField is one field of a standard five-field cron schedule
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] stands for min+i
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 6, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronDescriptors are the shorthands Argo CD's cron parser accepts
+var cronDescriptors = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+	"@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// validateCron checks a sync window schedule the way Argo CD parses it:
+// five fields of values, ranges, lists and steps, or a descriptor
+func validateCron(schedule string) error {
+	schedule = strings.TrimSpace(schedule)
+	if cronDescriptors[schedule] {
+		return nil
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("must be a cron schedule with 5 fields, got %q", schedule)
+	}
+	for i, f := range fields {
+		if err := cronFields[i].validate(f); err != nil {
+			return fmt.Errorf("%s: %v", cronFields[i].name, err)
+		}
+	}
+	return nil
+}
+
+func (c cronField) validate(field string) error {
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q", step)
+			}
+		}
+		if rng == "*" || rng == "?" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(rng, "-")
+		from, err := c.value(lo)
+		if err != nil {
+			return err
+		}
+		if !isRange {
+			continue
+		}
+		to, err := c.value(hi)
+		if err != nil {
+			return err
+		}
+		if from > to {
+			return fmt.Errorf("range %q ends before it starts", rng)
+		}
+	}
+	return nil
+}
+
+func (c cronField) value(s string) (int, error) {
+	for i, n := range c.names {
+		if strings.EqualFold(s, n) {
+			return c.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if n < c.min || n > c.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", n, c.min, c.max)
+	}
+	return n, nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Marshal renders a config as YAML using the same keys Load reads, in struct
+// field order and without empty values.
+func Marshal(c Config) ([]byte, error) {
+	node, err := encodeValue(reflect.ValueOf(c))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeValue(v reflect.Value) (*yaml.Node, error) {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		// nil inside free-form values such as helm valuesObject
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	// write sync policies that only set a mode in the short string form
+	if p, ok := v.Interface().(SyncPolicy); ok && reflect.DeepEqual(p, SyncPolicy{Mode: p.Mode}) {
+		return scalar(p.Mode)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+			if name == "" || name == "-" || !f.IsExported() || isEmpty(v.Field(i)) {
+				continue
+			}
+			val, err := encodeValue(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, val)
+		}
+		return n, nil
+	case reflect.Slice, reflect.Array:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			val, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, val)
+		}
+		return n, nil
+	case reflect.Map:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			val, err := encodeValue(v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: k.String()}, val)
+		}
+		return n, nil
+	default:
+		return scalar(v.Interface())
+	}
+}
+
+func scalar(v interface{}) (*yaml.Node, error) {
+	n := &yaml.Node{}
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// isEmpty reports whether a field holds nothing worth writing out
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// AppendCluster adds a cluster entry to the config file at path, keeping the
+// rest of the file, including comments, as it is.
+func AppendCluster(path string, c Cluster) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		// empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level must be a mapping", path)
+	}
+
+	entry, err := encodeValue(reflect.ValueOf(c))
+	if err != nil {
+		return err
+	}
+	clusters := findValue(root, "clusters")
+	switch {
+	case clusters == nil:
+		clusters = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "clusters"}, clusters)
+	case clusters.Tag == "!!null":
+		// "clusters:" without entries yet
+		*clusters = yaml.Node{Kind: yaml.SequenceNode}
+	case clusters.Kind != yaml.SequenceNode:
+		return fmt.Errorf("%s: clusters must be a list", path)
+	}
+	for _, existing := range clusters.Content {
+		if name := findValue(existing, "name"); name != nil && name.Value == c.Name {
+			return fmt.Errorf("%s: cluster %q already exists", path, c.Name)
+		}
+	}
+	clusters.Content = append(clusters.Content, entry)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// findValue returns the value of key in a mapping node, or nil
+func findValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
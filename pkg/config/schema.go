@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaURL is the JSON Schema dialect of the generated schema
+const SchemaURL = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema describing the config file format, generated
+// from the mapstructure tags of Config. Constraints come from `jsonschema`
+// tags: "required" and "enum=a|b|c".
+func Schema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	root := schemaFor(reflect.TypeOf(Config{}), defs)
+	root["$schema"] = SchemaURL
+	root["title"] = "rgo config"
+	root["$defs"] = defs
+	return root
+}
+
+func schemaFor(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(SyncPolicy{}):
+		// the legacy string form is still accepted
+		return map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string", "enum": []string{SyncModeAutomated, SyncModeManual}},
+				structRef(t, defs),
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		if t == reflect.TypeOf(Config{}) {
+			return structSchema(t, defs)
+		}
+		return structRef(t, defs)
+	default:
+		// interface{} and anything else accepts any value
+		return map[string]interface{}{}
+	}
+}
+
+// structRef registers t under $defs and returns a reference to it
+func structRef(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if _, ok := defs[t.Name()]; !ok {
+		defs[t.Name()] = nil // guard against recursive types
+		defs[t.Name()] = structSchema(t, defs)
+	}
+	return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		prop := schemaFor(f.Type, defs)
+		for _, opt := range strings.Split(f.Tag.Get("jsonschema"), ",") {
+			switch {
+			case opt == "required":
+				required = append(required, name)
+			case strings.HasPrefix(opt, "enum="):
+				prop["enum"] = strings.Split(strings.TrimPrefix(opt, "enum="), "|")
+			}
+		}
+		props[name] = prop
+	}
+
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ForTarget returns the part of the config that is deployed to the named target
+func (c Config) ForTarget(name string) Config {
+	out := c
+	out.Projects = selectTarget(c.Projects, name, func(p Project) []string { return p.Targets })
+	out.Applications = selectTarget(c.Applications, name, func(a Application) []string { return a.Targets })
+	out.Repositories = selectTarget(c.Repositories, name, func(r Repository) []string { return r.Targets })
+	out.Credentials = selectTarget(c.Credentials, name, func(cr Credential) []string { return cr.Targets })
+	out.Clusters = selectTarget(c.Clusters, name, func(cl Cluster) []string { return cl.Targets })
+	out.ApplicationSets = selectTarget(c.ApplicationSets, name, func(s ApplicationSet) []string { return s.Targets })
+	return out
+}
+
+func selectTarget[T any](items []T, name string, targets func(T) []string) []T {
+	var out []T
+	for _, item := range items {
+		if deployedTo(targets(item), name) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// deployedTo reports whether a resource selecting targets goes to name
+func deployedTo(targets []string, name string) bool {
+	return len(targets) == 0 || slices.Contains(targets, name)
+}
+
+// validateTargets checks the targets section and that every resource selects
+// declared targets, deployed together with the project, repositories and
+// destination cluster it uses
+func (c Config) validateTargets(errs *Errors) {
+	known := map[string]bool{}
+	for i, t := range c.Targets {
+		path := fmt.Sprintf("targets[%d]", i)
+		validateName(errs, path+".name", t.Name)
+		if known[t.Name] {
+			errs.addf(path+".name", "duplicate target %q", t.Name)
+		}
+		known[t.Name] = true
+		if t.Namespace != "" {
+			validateName(errs, path+".namespace", t.Namespace)
+		}
+	}
+
+	check := func(path string, targets []string) {
+		for j, t := range targets {
+			if !known[t] {
+				errs.addf(fmt.Sprintf("%s.targets[%d]", path, j), "unknown target %q", t)
+			}
+		}
+	}
+	projectTargets := map[string][]string{}
+	for i, p := range c.Projects {
+		check(fmt.Sprintf("projects[%d]", i), p.Targets)
+		projectTargets[p.Name] = p.Targets
+	}
+	// an application is only valid where its project exists
+	checkProject := func(path, project string, targets []string) {
+		pt, ok := projectTargets[project]
+		if !ok {
+			// default, or unknown and reported elsewhere
+			return
+		}
+		for _, t := range c.Targets {
+			if deployedTo(targets, t.Name) && !deployedTo(pt, t.Name) {
+				errs.addf(path+".targets", "project %q is not deployed to target %q", project, t.Name)
+			}
+		}
+	}
+	for i, a := range c.Applications {
+		path := fmt.Sprintf("applications[%d]", i)
+		check(path, a.Targets)
+		checkProject(path, a.Project, a.Targets)
+		c.checkDependencies(errs, path, a, a.Targets)
+	}
+	for i, s := range c.ApplicationSets {
+		path := fmt.Sprintf("applicationSets[%d]", i)
+		check(path, s.Targets)
+		if len(s.Template.Targets) > 0 {
+			errs.addf(path+".template.targets", "set targets on the application set, not its template")
+		}
+		if !isTemplated(s.Template.Project) {
+			checkProject(path, s.Template.Project, s.Targets)
+		}
+		c.checkDependencies(errs, path+".template", s.Template, s.Targets)
+	}
+	for i, r := range c.Repositories {
+		check(fmt.Sprintf("repositories[%d]", i), r.Targets)
+	}
+	for i, cr := range c.Credentials {
+		check(fmt.Sprintf("credentials[%d]", i), cr.Targets)
+	}
+	for i, cl := range c.Clusters {
+		check(fmt.Sprintf("clusters[%d]", i), cl.Targets)
+	}
+}
+
+// checkDependencies reports the targets an application is deployed to that
+// lack a declared repository it pulls from or its declared destination
+// cluster. Repositories and clusters the config does not declare, such as
+// public repositories and the in-cluster destination, are not checked.
+func (c Config) checkDependencies(errs *Errors, path string, a Application, targets []string) {
+	var urls []string
+	for _, url := range append([]string{a.SourceRepoURL, a.OCIRepoURL, a.ValuesRepoURL}, sourceURLs(a.Sources)...) {
+		if url != "" && !isTemplated(url) && !slices.ContainsFunc(urls, func(u string) bool { return sameRepoURL(u, url) }) {
+			urls = append(urls, url)
+		}
+	}
+	for _, t := range c.Targets {
+		if !deployedTo(targets, t.Name) {
+			continue
+		}
+		for _, url := range urls {
+			declared, deployed := false, false
+			for _, r := range c.Repositories {
+				if sameRepoURL(r.URL, url) {
+					declared = true
+					deployed = deployed || deployedTo(r.Targets, t.Name)
+				}
+			}
+			// a credential template deployed to the target also gives access
+			for _, cr := range c.Credentials {
+				deployed = deployed || (strings.HasPrefix(url, cr.URL) && deployedTo(cr.Targets, t.Name))
+			}
+			if declared && !deployed {
+				errs.addf(path+".targets", "repository %q is not deployed to target %q", url, t.Name)
+			}
+		}
+
+		if a.DestinationServer == "" || isTemplated(a.DestinationServer) {
+			continue
+		}
+		for _, cl := range c.Clusters {
+			if strings.TrimSuffix(cl.Server, "/") == strings.TrimSuffix(a.DestinationServer, "/") && !deployedTo(cl.Targets, t.Name) {
+				errs.addf(path+".targets", "cluster %q is not deployed to target %q", cl.Name, t.Name)
+			}
+		}
+	}
+}
+
+func sourceURLs(sources []Source) []string {
+	out := make([]string, 0, len(sources))
+	for _, s := range sources {
+		out = append(out, s.RepoURL)
+	}
+	return out
+}
+
+// sameRepoURL compares repository URLs the way the built secrets do, which
+// add .git to git URLs
+func sameRepoURL(a, b string) bool {
+	norm := func(u string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	}
+	return norm(a) == norm(b)
+}
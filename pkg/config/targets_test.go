@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTargetDependencies(t *testing.T) {
+	base := func() Config {
+		return Config{
+			Targets: []Target{{Name: "eu"}, {Name: "us"}},
+			Repositories: []Repository{
+				{URL: "https://github.com/x/private.git", Type: "git", Targets: []string{"eu"}},
+			},
+			Clusters: []Cluster{
+				{Name: "prod-eu", Server: "https://eu.example.com", Targets: []string{"eu"}},
+			},
+		}
+	}
+	app := func(repo, server string, targets ...string) Application {
+		return Application{
+			Name: "app", Project: "default", SourceRepoURL: repo, SourcePath: ".",
+			DestinationServer: server, DestinationNamespace: "default", Targets: targets,
+		}
+	}
+	tests := []struct {
+		name string
+		app  Application
+		want []string
+	}{
+		{
+			name: "dependencies deployed",
+			app:  app("https://github.com/x/private", "https://eu.example.com", "eu"),
+		},
+		{
+			name: "undeclared repository and in-cluster destination",
+			app:  app("https://github.com/x/public", "https://kubernetes.default.svc"),
+		},
+		{
+			name: "repository missing from a target",
+			app:  app("https://github.com/x/private", "https://kubernetes.default.svc"),
+			want: []string{`applications[0].targets: repository "https://github.com/x/private" is not deployed to target "us"`},
+		},
+		{
+			name: "cluster missing from a target",
+			app:  app("https://github.com/x/public", "https://eu.example.com/", "us"),
+			want: []string{`applications[0].targets: cluster "prod-eu" is not deployed to target "us"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base()
+			c.Applications = []Application{tt.app}
+			var errs Errors
+			c.validateTargets(&errs)
+			got := errs.Error()
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("errors %q do not contain %q", got, w)
+				}
+			}
+			if len(tt.want) == 0 && len(errs) > 0 {
+				t.Errorf("unexpected errors: %v", got)
+			}
+		})
+	}
+
+	// a credential template deployed to the target covers the repository
+	c := base()
+	c.Credentials = []Credential{{URL: "https://github.com/x/", Type: "git"}}
+	c.Applications = []Application{app("https://github.com/x/private", "https://kubernetes.default.svc")}
+	var errs Errors
+	c.validateTargets(&errs)
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors with a credential template: %v", errs.Error())
+	}
+}
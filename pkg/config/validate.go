@@ -0,0 +1,672 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// FieldError is a problem found at a YAML path such as applications[2].project
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Errors collects every problem found in a config
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, fe.Error())
+	}
+	return fmt.Sprintf("invalid config:\n  %s", strings.Join(lines, "\n  "))
+}
+
+func (e *Errors) addf(path, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the config for problems the API server would otherwise only
+// report mid-apply. It returns Errors listing all of them, or nil.
+func (c Config) Validate() error {
+	var errs Errors
+
+	projects := map[string]bool{"default": true}
+	for i, p := range c.Projects {
+		path := fmt.Sprintf("projects[%d]", i)
+		validateName(&errs, path+".name", p.Name)
+		switch {
+		case p.Name == "default":
+			// applying it would take over, and prune could delete, the built-in project
+			errs.addf(path+".name", "%q is the built-in Argo CD project and cannot be declared", p.Name)
+		case projects[p.Name]:
+			errs.addf(path+".name", "duplicate project %q", p.Name)
+		}
+		projects[p.Name] = true
+		validateProject(&errs, path, p)
+	}
+
+	apps := map[string]bool{}
+	for i, a := range c.Applications {
+		path := fmt.Sprintf("applications[%d]", i)
+		validateName(&errs, path+".name", a.Name)
+		if apps[a.Name] {
+			errs.addf(path+".name", "duplicate application %q", a.Name)
+		}
+		apps[a.Name] = true
+
+		validateApplication(&errs, path, a, projects)
+	}
+
+	sets := map[string]bool{}
+	for i, set := range c.ApplicationSets {
+		path := fmt.Sprintf("applicationSets[%d]", i)
+		validateName(&errs, path+".name", set.Name)
+		if sets[set.Name] {
+			errs.addf(path+".name", "duplicate application set %q", set.Name)
+		}
+		sets[set.Name] = true
+
+		if len(set.Generators) == 0 {
+			errs.addf(path+".generators", "at least one generator is required")
+		}
+		validateGenerators(&errs, path+".generators", set.Generators)
+
+		if set.Template.Name == "" {
+			errs.addf(path+".template.name", "is required")
+		} else if !isTemplated(set.Template.Name) {
+			validateName(&errs, path+".template.name", set.Template.Name)
+		}
+		validateApplication(&errs, path+".template", set.Template, projects)
+
+		if set.SyncPolicy != nil {
+			switch set.SyncPolicy.ApplicationsSync {
+			case "", "create-only", "create-update", "create-delete", "sync":
+			default:
+				errs.addf(path+".syncPolicy.applicationsSync", "must be one of create-only, create-update, create-delete, sync, got %q", set.SyncPolicy.ApplicationsSync)
+			}
+		}
+	}
+
+	for i, r := range c.Repositories {
+		path := fmt.Sprintf("repositories[%d]", i)
+		if r.URL == "" {
+			errs.addf(path+".url", "is required")
+		}
+		switch r.Type {
+		case "", "git", "helm", "oci":
+		default:
+			errs.addf(path+".type", "must be one of git, helm, oci, got %q", r.Type)
+		}
+		if r.Name != "" {
+			validateName(&errs, path+".name", r.Name)
+		}
+	}
+
+	for i, cr := range c.Credentials {
+		path := fmt.Sprintf("credentials[%d]", i)
+		if cr.URL == "" {
+			errs.addf(path+".url", "is required")
+		}
+		switch cr.Type {
+		case "", "git", "helm", "oci":
+		default:
+			errs.addf(path+".type", "must be one of git, helm, oci, got %q", cr.Type)
+		}
+		if cr.Name != "" {
+			validateName(&errs, path+".name", cr.Name)
+		}
+	}
+
+	if a := c.ArgoCD; a != nil {
+		if a.Server == "" {
+			errs.addf("argocd.server", "is required")
+		}
+		if (a.Username == "") != (a.Password == "") {
+			errs.addf("argocd", "username and password must be set together")
+		}
+		if a.AuthToken != "" && a.Username != "" {
+			errs.addf("argocd", "only one of authToken or username/password may be set")
+		}
+	}
+
+	clusters := map[string]bool{}
+	for i, cl := range c.Clusters {
+		path := fmt.Sprintf("clusters[%d]", i)
+		validateName(&errs, path+".name", cl.Name)
+		if clusters[cl.Name] {
+			errs.addf(path+".name", "duplicate cluster %q", cl.Name)
+		}
+		clusters[cl.Name] = true
+		if cl.Server == "" {
+			errs.addf(path+".server", "is required")
+		} else if !strings.HasPrefix(cl.Server, "https://") && !strings.HasPrefix(cl.Server, "http://") && !strings.HasPrefix(cl.Server, "${") {
+			errs.addf(path+".server", "must be an http(s) URL, got %q", cl.Server)
+		}
+		if cl.ClusterResources && len(cl.Namespaces) == 0 {
+			errs.addf(path+".clusterResources", "only applies together with namespaces")
+		}
+		if cl.Project != "" && !projects[cl.Project] {
+			errs.addf(path+".project", "unknown project %q", cl.Project)
+		}
+		// rgo sets these on the cluster secret and would silently override them
+		for _, key := range []string{"argocd.argoproj.io/secret-type", "managed-by", "created-at"} {
+			if _, ok := cl.Labels[key]; ok {
+				errs.addf(path+".labels", "%q is reserved for rgo", key)
+			}
+		}
+		for _, key := range []string{"rgo/updated-at", "rgo/content-hash"} {
+			if _, ok := cl.Annotations[key]; ok {
+				errs.addf(path+".annotations", "%q is reserved for rgo", key)
+			}
+		}
+		validateClusterConfig(&errs, path+".config", cl.Config)
+	}
+
+	if r := c.APIRetry; r != nil {
+		if r.MaxAttempts < 0 {
+			errs.addf("apiRetry.maxAttempts", "must not be negative, got %d", r.MaxAttempts)
+		}
+		checkDuration := func(field, value string) {
+			if d, err := time.ParseDuration(value); value != "" && (err != nil || d < 0) {
+				errs.addf("apiRetry."+field, "must be a duration such as 500ms or 30s, got %q", value)
+			}
+		}
+		checkDuration("backoff", r.Backoff)
+		checkDuration("maxBackoff", r.MaxBackoff)
+		if r.Jitter < 0 || r.Jitter > 1 {
+			errs.addf("apiRetry.jitter", "must be between 0 and 1, got %v", r.Jitter)
+		}
+	}
+
+	c.validateTargets(&errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateClusterConfig(errs *Errors, path string, c ClusterConfig) {
+	basic := c.Username != "" || c.Password != ""
+	if countTrue(c.BearerToken != "", basic, c.ExecProviderConfig != nil, c.AWSAuthConfig != nil, c.GCPAuth) > 1 {
+		errs.addf(path, "only one of bearerToken, username/password, execProviderConfig, awsAuthConfig or gcpAuth may be set")
+	}
+	if basic && (c.Username == "" || c.Password == "") {
+		errs.addf(path, "username and password must be set together")
+	}
+	if t := c.TLSClientConfig; t != nil {
+		if (t.CertData == "") != (t.KeyData == "") {
+			errs.addf(path+".tlsClientConfig", "certData and keyData must be set together")
+		}
+		if t.Insecure && t.CAData != "" {
+			errs.addf(path+".tlsClientConfig", "insecure and caData are mutually exclusive")
+		}
+	}
+	if e := c.ExecProviderConfig; e != nil && e.Command == "" {
+		errs.addf(path+".execProviderConfig.command", "is required")
+	}
+	if a := c.AWSAuthConfig; a != nil && a.ClusterName == "" {
+		errs.addf(path+".awsAuthConfig.clusterName", "is required")
+	}
+}
+
+func validateProject(errs *Errors, path string, p Project) {
+	for j, d := range p.Destinations {
+		if (d.Server == "") == (d.Name == "") {
+			errs.addf(fmt.Sprintf("%s.destinations[%d]", path, j), "exactly one of server or name is required")
+		}
+	}
+	for _, l := range []struct {
+		field string
+		list  []GroupKind
+	}{
+		{"clusterResourceWhitelist", p.ClusterResourceWhitelist},
+		{"clusterResourceBlacklist", p.ClusterResourceBlacklist},
+		{"namespaceResourceWhitelist", p.NamespaceResourceWhitelist},
+		{"namespaceResourceBlacklist", p.NamespaceResourceBlacklist},
+	} {
+		for j, gk := range l.list {
+			if gk.Kind == "" {
+				errs.addf(fmt.Sprintf("%s.%s[%d].kind", path, l.field, j), "is required")
+			}
+		}
+	}
+
+	roles := map[string]bool{}
+	for j, r := range p.Roles {
+		rp := fmt.Sprintf("%s.roles[%d]", path, j)
+		if !roleName.MatchString(r.Name) {
+			errs.addf(rp+".name", "must be alphanumeric with - or _ inside, got %q", r.Name)
+		}
+		if roles[r.Name] {
+			errs.addf(rp+".name", "duplicate role %q", r.Name)
+		}
+		roles[r.Name] = true
+		for k, policy := range r.Policies {
+			if err := validatePolicy(p.Name, r.Name, policy); err != nil {
+				errs.addf(fmt.Sprintf("%s.policies[%d]", rp, k), "%v", err)
+			}
+		}
+		for k, g := range r.Groups {
+			if strings.TrimSpace(g) == "" {
+				errs.addf(fmt.Sprintf("%s.groups[%d]", rp, k), "must not be empty")
+			}
+		}
+	}
+
+	for j, w := range p.SyncWindows {
+		wp := fmt.Sprintf("%s.syncWindows[%d]", path, j)
+		switch w.Kind {
+		case "allow", "deny":
+		default:
+			errs.addf(wp+".kind", "must be one of allow, deny, got %q", w.Kind)
+		}
+		if err := validateCron(w.Schedule); err != nil {
+			errs.addf(wp+".schedule", "%v", err)
+		}
+		if d, err := time.ParseDuration(w.Duration); err != nil || d <= 0 {
+			errs.addf(wp+".duration", "must be a positive duration such as 1h or 30m, got %q", w.Duration)
+		}
+		if len(w.Applications)+len(w.Namespaces)+len(w.Clusters) == 0 {
+			errs.addf(wp, "at least one of applications, namespaces or clusters is required")
+		}
+		if w.TimeZone != "" {
+			if _, err := time.LoadLocation(w.TimeZone); err != nil {
+				errs.addf(wp+".timeZone", "unknown time zone %q", w.TimeZone)
+			}
+		}
+	}
+}
+
+var roleName = regexp.MustCompile(`^[a-zA-Z0-9]([-_a-zA-Z0-9]*[a-zA-Z0-9])?$`)
+
+// policyActions are the actions Argo CD RBAC knows, besides action/<group>/<kind>/<name>
+var policyActions = map[string]bool{
+	"get": true, "create": true, "update": true, "delete": true, "sync": true,
+	"override": true, "action": true, "invoke": true, "*": true,
+}
+
+// validatePolicy checks a project role policy line:
+// p, proj:<project>:<role>, <resource>, <action>, <project>/<object>, allow|deny
+func validatePolicy(project, role, policy string) error {
+	fields := strings.Split(policy, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) != 6 || fields[0] != "p" {
+		return fmt.Errorf("must have the form \"p, proj:%s:%s, <resource>, <action>, %s/<object>, allow|deny\"", project, role, project)
+	}
+	if subject := "proj:" + project + ":" + role; fields[1] != subject {
+		return fmt.Errorf("subject must be %s, got %q", subject, fields[1])
+	}
+	switch fields[2] {
+	case "applications", "applicationsets", "repositories", "clusters", "logs", "exec", "*":
+	default:
+		return fmt.Errorf("unknown resource %q", fields[2])
+	}
+	if action := fields[3]; !policyActions[action] && !strings.HasPrefix(action, "action/") && !strings.HasPrefix(action, "update/") && !strings.HasPrefix(action, "delete/") {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if !strings.HasPrefix(fields[4], project+"/") {
+		return fmt.Errorf("object must start with %s/, got %q", project, fields[4])
+	}
+	if fields[5] != "allow" && fields[5] != "deny" {
+		return fmt.Errorf("effect must be allow or deny, got %q", fields[5])
+	}
+	return nil
+}
+
+func validateGenerators(errs *Errors, path string, generators []Generator) {
+	for i, g := range generators {
+		gp := fmt.Sprintf("%s[%d]", path, i)
+		if countTrue(g.List != nil, g.Clusters != nil, g.Git != nil, g.Matrix != nil) != 1 {
+			errs.addf(gp, "exactly one of list, clusters, git or matrix is required")
+			continue
+		}
+		switch {
+		case g.List != nil:
+			if len(g.List.Elements) == 0 {
+				errs.addf(gp+".list.elements", "at least one element is required")
+			}
+		case g.Git != nil:
+			if g.Git.RepoURL == "" {
+				errs.addf(gp+".git.repoURL", "is required")
+			}
+			if (len(g.Git.Directories) == 0) == (len(g.Git.Files) == 0) {
+				errs.addf(gp+".git", "exactly one of directories or files is required")
+			}
+		case g.Matrix != nil:
+			// Argo CD only combines two generators per matrix
+			if len(g.Matrix.Generators) != 2 {
+				errs.addf(gp+".matrix.generators", "exactly two generators are required, got %d", len(g.Matrix.Generators))
+			}
+			validateGenerators(errs, gp+".matrix.generators", g.Matrix.Generators)
+		}
+	}
+}
+
+// validateApplication checks one application, or an ApplicationSet template
+// whose fields may hold {{...}} placeholders
+func validateApplication(errs *Errors, path string, a Application, projects map[string]bool) {
+	if a.Project == "" {
+		errs.addf(path+".project", "is required")
+	} else if !projects[a.Project] && !isTemplated(a.Project) {
+		errs.addf(path+".project", "references undefined project %q", a.Project)
+	}
+	if a.DestinationServer == "" {
+		errs.addf(path+".destinationServer", "is required")
+	}
+
+	switch {
+	case len(a.Sources) > 0:
+		if a.SourceRepoURL != "" || a.HelmSource() || a.IsOCI || a.Kustomize != nil || a.Directory != nil || a.Plugin != nil {
+			errs.addf(path+".sources", "cannot be combined with sourceRepoURL, isHelm, helm, isOCI, kustomize, directory or plugin")
+		}
+		validateSources(errs, path+".sources", a.Sources)
+	case a.IsOCI:
+		if !a.HelmSource() {
+			errs.addf(path+".isOCI", "requires isHelm")
+		}
+		if a.OCIRepoURL == "" {
+			errs.addf(path+".ociRepoURL", "is required when isOCI is set")
+		}
+		if a.OCIChartName == "" {
+			errs.addf(path+".ociChartName", "is required when isOCI is set")
+		}
+		// the values repository is exposed as the "values" ref
+		validateValueRefs(errs, path+".helmValueFiles", a.HelmValueFiles, map[string]bool{"values": true})
+		validateHelm(errs, path+".helm", a.Helm, map[string]bool{"values": true})
+	default:
+		if a.SourceRepoURL == "" {
+			errs.addf(path+".sourceRepoURL", "is required")
+		}
+		validateValueRefs(errs, path+".helmValueFiles", a.HelmValueFiles, nil)
+		validateHelm(errs, path+".helm", a.Helm, nil)
+	}
+
+	if countTrue(a.HelmSource(), a.Kustomize != nil, a.Directory != nil, a.Plugin != nil) > 1 {
+		errs.addf(path, "only one of helm, kustomize, directory or plugin may be set")
+	}
+	if a.Kustomize != nil {
+		validateKustomize(errs, path+".kustomize", *a.Kustomize)
+	}
+	if a.Directory != nil {
+		validateDirectory(errs, path+".directory", *a.Directory)
+	}
+	if a.Plugin != nil {
+		validatePlugin(errs, path+".plugin", *a.Plugin)
+	}
+
+	switch a.SyncPolicy.Mode {
+	case "", SyncModeAutomated:
+	case SyncModeManual:
+		// these only tune automated sync, which manual mode leaves out
+		if a.SyncPolicy.Prune != nil {
+			errs.addf(path+".syncPolicy.prune", "has no effect with mode %q", SyncModeManual)
+		}
+		if a.SyncPolicy.SelfHeal != nil {
+			errs.addf(path+".syncPolicy.selfHeal", "has no effect with mode %q", SyncModeManual)
+		}
+		if a.SyncPolicy.AllowEmpty {
+			errs.addf(path+".syncPolicy.allowEmpty", "has no effect with mode %q", SyncModeManual)
+		}
+	default:
+		errs.addf(path+".syncPolicy.mode", "must be %q or %q, got %q", SyncModeAutomated, SyncModeManual, a.SyncPolicy.Mode)
+	}
+}
+
+func validateSources(errs *Errors, path string, sources []Source) {
+	refs := map[string]bool{}
+	for i, src := range sources {
+		if src.Ref == "" {
+			continue
+		}
+		if refs[src.Ref] {
+			errs.addf(fmt.Sprintf("%s[%d].ref", path, i), "duplicate ref %q", src.Ref)
+		}
+		refs[src.Ref] = true
+	}
+
+	for i, src := range sources {
+		sp := fmt.Sprintf("%s[%d]", path, i)
+		if src.RepoURL == "" {
+			errs.addf(sp+".repoURL", "is required")
+		}
+		switch t := src.SourceType(); t {
+		case SourceTypeOCI:
+			if src.Chart == "" {
+				errs.addf(sp+".chart", "is required for oci sources")
+			}
+		case SourceTypeHelm:
+			if src.Chart == "" && src.Path == "" {
+				errs.addf(sp, "helm sources need a chart or a path")
+			}
+		case SourceTypeGit, SourceTypeKustomize:
+			if len(src.HelmValueFiles) > 0 || src.Helm != nil {
+				errs.addf(sp, "helmValueFiles and helm are only valid for helm and oci sources")
+			}
+			if t == SourceTypeKustomize && (src.Directory != nil || src.Plugin != nil) {
+				errs.addf(sp, "directory and plugin are only valid for git sources")
+			}
+		default:
+			errs.addf(sp+".type", "must be one of git, helm, oci, kustomize, got %q", t)
+		}
+		if src.Kustomize != nil {
+			if src.SourceType() != SourceTypeKustomize {
+				errs.addf(sp+".kustomize", "requires type kustomize")
+			}
+			validateKustomize(errs, sp+".kustomize", *src.Kustomize)
+		}
+		if src.Directory != nil && src.Plugin != nil {
+			errs.addf(sp, "only one of directory or plugin may be set")
+		}
+		if src.Directory != nil {
+			validateDirectory(errs, sp+".directory", *src.Directory)
+		}
+		if src.Plugin != nil {
+			validatePlugin(errs, sp+".plugin", *src.Plugin)
+		}
+		validateValueRefs(errs, sp+".helmValueFiles", src.HelmValueFiles, refs)
+		validateHelm(errs, sp+".helm", src.Helm, refs)
+	}
+}
+
+func validateDirectory(errs *Errors, path string, d Directory) {
+	if d.Jsonnet == nil {
+		return
+	}
+	for i, v := range d.Jsonnet.TLAs {
+		if v.Name == "" {
+			errs.addf(fmt.Sprintf("%s.jsonnet.tlas[%d].name", path, i), "is required")
+		}
+	}
+	for i, v := range d.Jsonnet.ExtVars {
+		if v.Name == "" {
+			errs.addf(fmt.Sprintf("%s.jsonnet.extVars[%d].name", path, i), "is required")
+		}
+	}
+}
+
+func validatePlugin(errs *Errors, path string, p Plugin) {
+	for i, e := range p.Env {
+		for _, msg := range validation.IsEnvVarName(e.Name) {
+			errs.addf(fmt.Sprintf("%s.env[%d].name", path, i), "%q is not a valid variable name: %s", e.Name, msg)
+		}
+	}
+	for i, param := range p.Parameters {
+		pp := fmt.Sprintf("%s.parameters[%d]", path, i)
+		if param.Name == "" {
+			errs.addf(pp+".name", "is required")
+		}
+		if countTrue(param.String != "", len(param.Array) > 0, len(param.Map) > 0) > 1 {
+			errs.addf(pp, "only one of string, array or map may be set")
+		}
+	}
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+func validateHelm(errs *Errors, path string, h *Helm, refs map[string]bool) {
+	if h == nil {
+		return
+	}
+	validateValueRefs(errs, path+".valueFiles", h.ValueFiles, refs)
+	if h.Values != "" && len(h.ValuesObject) > 0 {
+		errs.addf(path, "values and valuesObject are mutually exclusive")
+	}
+	switch h.Version {
+	case "", "v2", "v3":
+	default:
+		errs.addf(path+".version", "must be v2 or v3, got %q", h.Version)
+	}
+	for i, p := range h.Parameters {
+		if p.Name == "" {
+			errs.addf(fmt.Sprintf("%s.parameters[%d].name", path, i), "is required")
+		}
+	}
+	for i, p := range h.FileParameters {
+		pp := fmt.Sprintf("%s.fileParameters[%d]", path, i)
+		if p.Name == "" {
+			errs.addf(pp+".name", "is required")
+		}
+		if p.Path == "" {
+			errs.addf(pp+".path", "is required")
+		}
+	}
+}
+
+// validateValueRefs checks that every $ref/path value file names a declared ref
+func validateValueRefs(errs *Errors, path string, files []string, refs map[string]bool) {
+	for i, f := range files {
+		if !strings.HasPrefix(f, "$") {
+			continue
+		}
+		ref, _, _ := strings.Cut(f[1:], "/")
+		if !refs[ref] {
+			errs.addf(fmt.Sprintf("%s[%d]", path, i), "references undeclared source ref %q", ref)
+		}
+	}
+}
+
+func validateKustomize(errs *Errors, path string, k Kustomize) {
+	for i, img := range k.Images {
+		if strings.TrimSpace(img) == "" {
+			errs.addf(fmt.Sprintf("%s.images[%d]", path, i), "must not be empty")
+		}
+	}
+	for key, value := range k.CommonLabels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs.addf(path+".commonLabels."+key, "invalid label key: %s", msg)
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs.addf(path+".commonLabels."+key, "invalid label value: %s", msg)
+		}
+	}
+	for key := range k.CommonAnnotations {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs.addf(path+".commonAnnotations."+key, "invalid annotation key: %s", msg)
+		}
+	}
+	if k.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(k.Namespace) {
+			errs.addf(path+".namespace", "%q is not a valid namespace: %s", k.Namespace, msg)
+		}
+	}
+	for i, r := range k.Replicas {
+		rp := fmt.Sprintf("%s.replicas[%d]", path, i)
+		if r.Name == "" {
+			errs.addf(rp+".name", "is required")
+		}
+		if r.Count < 0 {
+			errs.addf(rp+".count", "must not be negative")
+		}
+	}
+	for i, p := range k.Patches {
+		pp := fmt.Sprintf("%s.patches[%d]", path, i)
+		if (p.Patch == "") == (p.Path == "") {
+			errs.addf(pp, "exactly one of patch or path is required")
+		}
+	}
+}
+
+// isTemplated reports whether s holds an ApplicationSet template placeholder
+func isTemplated(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// validateName checks that a resource name is a valid DNS-1123 subdomain
+func validateName(errs *Errors, path, name string) {
+	if name == "" {
+		errs.addf(path, "is required")
+		return
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		errs.addf(path, "%q is not a valid name: %s", name, msg)
+	}
+}
+
+// decodeErrors converts mapstructure errors into Errors with YAML paths
+func decodeErrors(err error) error {
+	var errs Errors
+	var walk func(error)
+	walk = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				walk(e)
+			}
+			return
+		}
+		de, ok := err.(*mapstructure.DecodeError)
+		if !ok {
+			if inner := errors.Unwrap(err); inner != nil {
+				walk(inner)
+			} else {
+				errs.addf("", "%s", err)
+			}
+			return
+		}
+		inner := de.Unwrap()
+		if _, ok := inner.(interface{ Unwrap() []error }); ok {
+			walk(inner)
+			return
+		}
+		if keys, ok := strings.CutPrefix(inner.Error(), "has invalid keys: "); ok {
+			for _, k := range strings.Split(keys, ", ") {
+				errs.addf(joinPath(de.Name(), k), "unknown key")
+			}
+			return
+		}
+		errs.addf(de.Name(), "%s", inner)
+	}
+	walk(err)
+	return errs
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff between a and b with the given number of
+// context lines, or an empty string if they are equal.
+func Unified(a, b, fromName, toName string, context int, color bool) string {
+	if a == b {
+		return ""
+	}
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	write := func(c, s string) {
+		if color && c != "" {
+			sb.WriteString(c + s + colorReset + "\n")
+			return
+		}
+		sb.WriteString(s + "\n")
+	}
+	write("", "--- "+fromName)
+	write("", "+++ "+toName)
+
+	for _, h := range hunks(ops, context) {
+		write(colorCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.aStart, h.aLen, h.bStart, h.bLen))
+		for _, o := range ops[h.from:h.to] {
+			switch o.kind {
+			case opEqual:
+				write("", " "+o.line)
+			case opDelete:
+				write(colorRed, "-"+o.line)
+			case opInsert:
+				write(colorGreen, "+"+o.line)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lineOps computes an edit script from a to b using a longest common
+// subsequence table, which is fast enough for manifest-sized inputs.
+func lineOps(a, b []string) []op {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{opEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{opDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, op{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{opDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{opInsert, b[j]})
+	}
+	return ops
+}
+
+type hunk struct {
+	from, to     int // range in ops
+	aStart, aLen int
+	bStart, bLen int
+}
+
+// hunks groups changed ops together with their surrounding context.
+func hunks(ops []op, context int) []hunk {
+	var out []hunk
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		from := max(i-context, 0)
+		// extend until we see more than 2*context equal lines in a row
+		to, equal := i, 0
+		for to < len(ops) && equal <= 2*context {
+			if ops[to].kind == opEqual {
+				equal++
+			} else {
+				equal = 0
+			}
+			to++
+		}
+		if equal > context {
+			to -= equal - context
+		}
+		out = append(out, hunk{from: from, to: to})
+		i = to
+	}
+
+	// compute line numbers for each hunk
+	aLine, bLine, k := 1, 1, 0
+	for idx, o := range ops {
+		if k < len(out) && idx == out[k].from {
+			out[k].aStart, out[k].bStart = aLine, bLine
+		}
+		if k < len(out) && idx >= out[k].from && idx < out[k].to {
+			if o.kind != opInsert {
+				out[k].aLen++
+			}
+			if o.kind != opDelete {
+				out[k].bLen++
+			}
+			if idx == out[k].to-1 {
+				k++
+			}
+		}
+		if o.kind != opInsert {
+			aLine++
+		}
+		if o.kind != opDelete {
+			bLine++
+		}
+	}
+	for i := range out {
+		// unified diff convention for empty ranges
+		if out[i].aLen == 0 {
+			out[i].aStart--
+		}
+		if out[i].bLen == 0 {
+			out[i].bStart--
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func lines(s ...string) string {
+	return strings.Join(s, "\n") + "\n"
+}
+
+func TestUnified(t *testing.T) {
+	base := lines("1", "2", "3", "4", "5", "6", "7", "8")
+	tests := []struct {
+		name string
+		a, b string
+		want string // hunks only, without the file header
+	}{
+		{
+			name: "equal",
+			a:    base,
+			b:    base,
+		},
+		{
+			name: "insert at start",
+			a:    base,
+			b:    lines("0", "1", "2", "3", "4", "5", "6", "7", "8"),
+			want: lines("@@ -1,1 +1,2 @@", "+0", " 1"),
+		},
+		{
+			name: "insert at end",
+			a:    base,
+			b:    lines("1", "2", "3", "4", "5", "6", "7", "8", "9"),
+			want: lines("@@ -8,1 +8,2 @@", " 8", "+9"),
+		},
+		{
+			name: "delete at start",
+			a:    base,
+			b:    lines("2", "3", "4", "5", "6", "7", "8"),
+			want: lines("@@ -1,2 +1,1 @@", "-1", " 2"),
+		},
+		{
+			name: "delete at end",
+			a:    base,
+			b:    lines("1", "2", "3", "4", "5", "6", "7"),
+			want: lines("@@ -7,2 +7,1 @@", " 7", "-8"),
+		},
+		{
+			name: "into an empty file",
+			a:    "",
+			b:    lines("1", "2"),
+			want: lines("@@ -0,0 +1,2 @@", "+1", "+2"),
+		},
+		{
+			name: "everything deleted",
+			a:    lines("1", "2"),
+			b:    "",
+			want: lines("@@ -1,2 +0,0 @@", "-1", "-2"),
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    base,
+			b:    lines("1", "2", "x", "4", "y", "6", "7", "8"),
+			want: lines("@@ -2,5 +2,5 @@", " 2", "-3", "+x", " 4", "-5", "+y", " 6"),
+		},
+		{
+			name: "changes twice the context apart share a hunk",
+			a:    base,
+			b:    lines("1", "x", "3", "4", "y", "6", "7", "8"),
+			want: lines("@@ -1,6 +1,6 @@", " 1", "-2", "+x", " 3", " 4", "-5", "+y", " 6"),
+		},
+		{
+			name: "distant changes get their own hunks",
+			a:    base,
+			b:    lines("1", "x", "3", "4", "5", "y", "7", "8"),
+			want: lines("@@ -1,3 +1,3 @@", " 1", "-2", "+x", " 3", "@@ -5,3 +5,3 @@", " 5", "-6", "+y", " 7"),
+		},
+		{
+			name: "line numbers shift after an insertion",
+			a:    base,
+			b:    lines("0", "1", "2", "3", "4", "5", "y", "7", "8"),
+			want: lines("@@ -1,1 +1,2 @@", "+0", " 1", "@@ -5,3 +6,3 @@", " 5", "-6", "+y", " 7"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified(tt.a, tt.b, "live", "desired", 1, false)
+			if tt.want == "" {
+				if got != "" {
+					t.Fatalf("got a diff for equal input:\n%s", got)
+				}
+				return
+			}
+			header := "--- live\n+++ desired\n"
+			if !strings.HasPrefix(got, header) {
+				t.Fatalf("missing file header:\n%s", got)
+			}
+			if got = strings.TrimPrefix(got, header); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedColor(t *testing.T) {
+	got := Unified(lines("a"), lines("b"), "live", "desired", 3, true)
+	for _, want := range []string{colorCyan + "@@ -1,1 +1,1 @@" + colorReset, colorRed + "-a" + colorReset, colorGreen + "+b" + colorReset} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q does not contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, colorRed+"---") {
+		t.Errorf("file header colored: %q", got)
+	}
+}
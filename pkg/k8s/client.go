@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"sigs.k8s.io/yaml"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -22,50 +26,275 @@ type Object struct {
 	NS  string
 }
 
-// New returns a dynamic client using in-cluster config or local kubeconfig fallback
-func New() (*Client, error) {
-	cfg, err := rest.InClusterConfig()
+// CopyObject returns a deep copy of obj. Built objects hold typed slices such
+// as []string, which DeepCopy rejects, so the copy goes through JSON.
+func CopyObject(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	b, err := json.Marshal(obj.Object)
 	if err != nil {
-		loading := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
-		)
-		cfg, err = loading.ClientConfig()
-		if err != nil {
-			return nil, err
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
+
+// FieldManager identifies rgo as the owner of fields it applies server-side
+const FieldManager = "rgo"
+
+// Options configures how a Client connects and writes objects
+type Options struct {
+	// ServerSide uses server-side apply instead of get + create/update
+	ServerSide bool
+	// ForceConflicts takes ownership of fields managed by other field managers
+	ForceConflicts bool
+	// Retry applies to Apply and Delete
+	Retry RetryPolicy
+	// AlwaysUpdate writes objects even when the live object already matches
+	AlwaysUpdate bool
+	// PreserveLive, when set, copies fields other writers own from the live
+	// object, which is nil for new objects, into the desired one before Apply
+	// compares and writes it
+	PreserveLive func(obj, live *unstructured.Unstructured)
+
+	Connection
+}
+
+// Connection selects the cluster and identity a Client talks to
+type Connection struct {
+	// Kubeconfig and Context select a kubeconfig context; empty values use
+	// the defaults kubectl uses. Setting either skips in-cluster config.
+	Kubeconfig string
+	Context    string
+	// PreferKubeconfig tries the kubeconfig before in-cluster config, for CI
+	// jobs that run in a pod but deploy elsewhere
+	PreferKubeconfig bool
+
+	// Impersonate and ImpersonateGroups act as another user, like kubectl --as
+	Impersonate       string
+	ImpersonateGroups []string
+
+	Timeout time.Duration // per request; zero means no timeout
+	QPS     float32       // zero keeps the client-go default
+	Burst   int
+}
+
+// New returns a dynamic client using in-cluster config or local kubeconfig
+// fallback, in the order the connection options ask for
+func New(opts Options) (*Client, error) {
+	cfg, err := opts.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewForConfig(cfg, opts)
+}
+
+func (c Connection) restConfig() (*rest.Config, error) {
+	if len(c.ImpersonateGroups) > 0 && c.Impersonate == "" {
+		return nil, fmt.Errorf("impersonating groups requires a user to impersonate")
+	}
+
+	kubeconfig := func() (*rest.Config, error) {
+		cfg, _, err := LoadKubeconfig(c.Kubeconfig, c.Context)
+		return cfg, err
+	}
+	var cfg *rest.Config
+	var err error
+	switch {
+	case c.Kubeconfig != "" || c.Context != "":
+		cfg, err = kubeconfig()
+	case c.PreferKubeconfig:
+		if cfg, err = kubeconfig(); err != nil {
+			cfg, err = rest.InClusterConfig()
+		}
+	default:
+		if cfg, err = rest.InClusterConfig(); err != nil {
+			cfg, err = kubeconfig()
 		}
 	}
-	dc, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{dc: dc}, nil
+
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: c.Impersonate, Groups: c.ImpersonateGroups}
+	if c.Timeout > 0 {
+		cfg.Timeout = c.Timeout
+	}
+	if c.QPS > 0 {
+		cfg.QPS = c.QPS
+	}
+	if c.Burst > 0 {
+		cfg.Burst = c.Burst
+	}
+	return cfg, nil
 }
 
-type Client struct{ dc dynamic.Interface }
+// NewForConfig returns a dynamic client for an explicit REST config, such as
+// a cluster being registered with Argo CD
+func NewForConfig(cfg *rest.Config, opts Options) (*Client, error) {
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{dc: dc, opts: opts}, nil
+}
 
-// Apply creates or updates an object
-func (c *Client) Apply(ctx context.Context, o Object) error {
-	res := c.resource(o)
-	name := o.Obj.GetName()
-	// try get
-	existing, err := res.Get(ctx, name, metav1.GetOptions{})
+// LoadKubeconfig returns the REST config of a kubeconfig context together with
+// the context name. Empty path and context select the defaults kubectl uses.
+func LoadKubeconfig(path, context string) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		rules.ExplicitPath = path
+	}
+	loading := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, &clientcmd.ConfigOverrides{CurrentContext: context},
+	)
+	raw, err := loading.RawConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	if context == "" {
+		context = raw.CurrentContext
+	}
+	if context == "" {
+		return nil, "", fmt.Errorf("no kubeconfig context: set --context or a current context")
+	}
+	if _, ok := raw.Contexts[context]; !ok {
+		return nil, "", fmt.Errorf("context %q not found in kubeconfig", context)
+	}
+	cfg, err := loading.ClientConfig()
 	if err != nil {
+		return nil, "", err
+	}
+	return cfg, context, nil
+}
+
+type Client struct {
+	dc   dynamic.Interface
+	opts Options
+}
+
+// Apply creates or updates an object, server-side when enabled. It reports
+// false without writing when the live object already matches: the content
+// hash rgo last applied rules out most writes, and a dry run confirms that
+// the object was not changed outside rgo since.
+func (c *Client) Apply(ctx context.Context, o Object) (bool, error) {
+	var changed bool
+	// the live object is read afresh on every attempt, so a 409 from a stale
+	// resourceVersion is worth retrying; with server-side apply a 409 is a
+	// field ownership conflict, which retrying cannot solve
+	err := c.opts.Retry.retry(ctx, o, !c.opts.ServerSide, func() error {
+		live, err := c.Get(ctx, o)
 		if apierrors.IsNotFound(err) {
-			_, err = res.Create(ctx, o.Obj, metav1.CreateOptions{})
+			live, err = nil, nil
+		}
+		if err != nil {
 			return err
 		}
+		if c.opts.PreserveLive != nil {
+			c.opts.PreserveLive(o.Obj, live)
+		}
+		hash, err := contentHash(o.Obj)
+		if err != nil {
+			return err
+		}
+		if live != nil && !c.opts.AlwaysUpdate && live.GetAnnotations()[AnnotationContentHash] == hash {
+			carryStamp(o.Obj, live)
+			result, err := c.write(ctx, o, live, true)
+			if err != nil {
+				return err
+			}
+			if changed = !sameAsLive(result, live); !changed {
+				return nil
+			}
+		}
+		changed = true
+		stamp(o.Obj, live, hash)
+		_, err = c.write(ctx, o, live, false)
 		return err
+	})
+	return changed, err
+}
+
+// write applies an object server-side when enabled, and otherwise falls back
+// to create or update for clusters without server-side apply. A dry run
+// returns the object as it would be stored without storing it.
+func (c *Client) write(ctx context.Context, o Object, live *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	var dry []string
+	if dryRun {
+		dry = []string{metav1.DryRunAll}
+	}
+	res := c.resource(o)
+	if c.opts.ServerSide {
+		return res.Apply(ctx, o.Obj.GetName(), o.Obj, metav1.ApplyOptions{
+			FieldManager: FieldManager,
+			Force:        c.opts.ForceConflicts,
+			DryRun:       dry,
+		})
+	}
+	if live == nil {
+		return res.Create(ctx, o.Obj, metav1.CreateOptions{DryRun: dry})
 	}
 	// update with resourceVersion
-	o.Obj.SetResourceVersion(existing.GetResourceVersion())
-	_, err = res.Update(ctx, o.Obj, metav1.UpdateOptions{})
-	return err
+	o.Obj.SetResourceVersion(live.GetResourceVersion())
+	return res.Update(ctx, o.Obj, metav1.UpdateOptions{DryRun: dry})
+}
+
+// Get fetches the live version of an object
+func (c *Client) Get(ctx context.Context, o Object) (*unstructured.Unstructured, error) {
+	return c.resource(o).Get(ctx, o.Obj.GetName(), metav1.GetOptions{})
+}
+
+// List returns the objects of a resource type in ns matching a label selector
+func (c *Client) List(ctx context.Context, gvr schema.GroupVersionResource, ns, selector string) ([]Object, error) {
+	res := c.resource(Object{GVR: gvr, NS: ns})
+	list, err := res.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Object, 0, len(list.Items))
+	for i := range list.Items {
+		out = append(out, Object{Obj: &list.Items[i], GVR: gvr, NS: ns})
+	}
+	return out, nil
+}
+
+// Watch streams changes to a single object
+func (c *Client) Watch(ctx context.Context, o Object) (watch.Interface, error) {
+	return c.resource(o).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", o.Obj.GetName()).String(),
+	})
+}
+
+// Label sets one label on the live object, leaving the rest of it as it is
+func (c *Client) Label(ctx context.Context, o Object, key, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]string{key: value}},
+	})
+	if err != nil {
+		return err
+	}
+	return c.opts.Retry.retry(ctx, o, false, func() error {
+		_, err := c.resource(o).Patch(ctx, o.Obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
 }
 
 // Delete removes object by name
 func (c *Client) Delete(ctx context.Context, o Object) error {
 	res := c.resource(o)
-	return res.Delete(ctx, o.Obj.GetName(), metav1.DeleteOptions{})
+	attempt := 0
+	return c.opts.Retry.retry(ctx, o, false, func() error {
+		attempt++
+		err := res.Delete(ctx, o.Obj.GetName(), metav1.DeleteOptions{})
+		// an earlier attempt may have deleted the object before its
+		// response was lost
+		if attempt > 1 && apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
 }
 
 func (c *Client) resource(o Object) dynamic.ResourceInterface {
@@ -110,6 +339,10 @@ func ObjectForDelete(kind, name, ns string) (Object, error) {
 		return Object{Obj: &unstructured.Unstructured{Object: map[string]interface{}{
 			"apiVersion": "argoproj.io/v1alpha1", "kind": "Application", "metadata": map[string]interface{}{"name": name, "namespace": ns},
 		}}, GVR: schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}, NS: ns}, nil
+	case "appset", "applicationset":
+		return Object{Obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1", "kind": "ApplicationSet", "metadata": map[string]interface{}{"name": name, "namespace": ns},
+		}}, GVR: schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applicationsets"}, NS: ns}, nil
 	case "project", "appproject":
 		return Object{Obj: &unstructured.Unstructured{Object: map[string]interface{}{
 			"apiVersion": "argoproj.io/v1alpha1", "kind": "AppProject", "metadata": map[string]interface{}{"name": name, "namespace": ns},
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of applying one object
+type Result struct {
+	Object  Object
+	Err     error
+	Skipped string // why the object was not applied, if it was not
+	// Unchanged is set when the live object already matched
+	Unchanged bool
+	Duration  time.Duration
+}
+
+// Failed reports whether the object was not applied, by error or skip
+func (r Result) Failed() bool {
+	return r.Err != nil || r.Skipped != ""
+}
+
+// Applier writes one object, reporting whether it changed. *Client is one.
+type Applier interface {
+	Apply(ctx context.Context, o Object) (bool, error)
+}
+
+// Executor applies objects stage by stage with a bounded number of workers.
+// A stage starts once every object of the previous stage is done, and a
+// failing object does not stop the others.
+type Executor struct {
+	Client   Applier
+	Parallel int           // workers per stage; values below 1 mean 1
+	Timeout  time.Duration // per object; zero means none
+
+	// Skip, when set, returns why an object should not be applied given the
+	// objects that failed in earlier stages, or "" to apply it
+	Skip func(o Object, failed []Object) string
+	// OnResult, when set, is called as each object finishes. Calls are
+	// serialized.
+	OnResult func(Result)
+}
+
+// Run applies the stages in order and returns a result per object, in the
+// order of the stages
+func (e *Executor) Run(ctx context.Context, stages [][]Object) []Result {
+	var (
+		results []Result
+		failed  []Object
+		mu      sync.Mutex
+	)
+	report := func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.OnResult != nil {
+			e.OnResult(r)
+		}
+	}
+
+	for _, stage := range stages {
+		stageResults := make([]Result, len(stage))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < max(e.Parallel, 1); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					stageResults[i] = e.apply(ctx, stage[i], failed)
+					report(stageResults[i])
+				}
+			}()
+		}
+		for i := range stage {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		for _, r := range stageResults {
+			if r.Failed() {
+				failed = append(failed, r.Object)
+			}
+		}
+		results = append(results, stageResults...)
+	}
+	return results
+}
+
+func (e *Executor) apply(ctx context.Context, o Object, failed []Object) Result {
+	if e.Skip != nil {
+		if reason := e.Skip(o, failed); reason != "" {
+			return Result{Object: o, Skipped: reason}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{Object: o, Err: err}
+	}
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	changed, err := e.Client.Apply(ctx, o)
+	return Result{Object: o, Err: err, Unchanged: err == nil && !changed, Duration: time.Since(start)}
+}
@@ -0,0 +1,144 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeApplier records the objects it applies and how many ran at once
+type fakeApplier struct {
+	delay time.Duration
+	fail  map[string]bool
+	block bool // wait for the context instead of applying
+
+	mu      sync.Mutex
+	applied []string
+	running int
+	peak    int
+}
+
+func (f *fakeApplier) Apply(ctx context.Context, o Object) (bool, error) {
+	f.mu.Lock()
+	f.running++
+	f.peak = max(f.peak, f.running)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.applied = append(f.applied, o.Obj.GetName())
+		f.mu.Unlock()
+	}()
+
+	if f.block {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	time.Sleep(f.delay)
+	if f.fail[o.Obj.GetName()] {
+		return false, errors.New("rejected")
+	}
+	return true, nil
+}
+
+func testObjects(names ...string) []Object {
+	out := make([]Object, 0, len(names))
+	for _, n := range names {
+		out = append(out, Object{Obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"kind":     "ConfigMap",
+			"metadata": map[string]interface{}{"name": n},
+		}}})
+	}
+	return out
+}
+
+func TestExecutorStageOrder(t *testing.T) {
+	fake := &fakeApplier{delay: 5 * time.Millisecond}
+	e := &Executor{Client: fake, Parallel: 4}
+	results := e.Run(context.Background(), [][]Object{
+		testObjects("p1", "p2", "p3"),
+		testObjects("a1", "a2"),
+	})
+
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+	// results follow the stages; completion order within a stage may vary
+	for i, want := range []string{"p1", "p2", "p3", "a1", "a2"} {
+		if got := results[i].Object.Obj.GetName(); got != want {
+			t.Errorf("results[%d] = %s, want %s", i, got, want)
+		}
+	}
+	for i, name := range fake.applied {
+		if stage := name[0]; i < 3 && stage != 'p' || i >= 3 && stage != 'a' {
+			t.Fatalf("applied %v: a stage started before the previous one finished", fake.applied)
+		}
+	}
+}
+
+func TestExecutorSkipsDependents(t *testing.T) {
+	fake := &fakeApplier{fail: map[string]bool{"p2": true}}
+	var seen []string
+	e := &Executor{
+		Client: fake,
+		Skip: func(o Object, failed []Object) string {
+			for _, f := range failed {
+				if o.Obj.GetName() == "a2" && f.Obj.GetName() == "p2" {
+					return "p2 failed"
+				}
+			}
+			return ""
+		},
+		OnResult: func(r Result) { seen = append(seen, r.Object.Obj.GetName()) },
+	}
+	results := e.Run(context.Background(), [][]Object{
+		testObjects("p1", "p2"),
+		testObjects("a1", "a2"),
+	})
+
+	want := []struct {
+		err     bool
+		skipped string
+	}{{}, {err: true}, {}, {skipped: "p2 failed"}}
+	for i, w := range want {
+		r := results[i]
+		if (r.Err != nil) != w.err || r.Skipped != w.skipped {
+			t.Errorf("%s: err=%v skipped=%q, want err=%v skipped=%q", r.Object.Obj.GetName(), r.Err, r.Skipped, w.err, w.skipped)
+		}
+	}
+	if len(fake.applied) != 3 {
+		t.Errorf("applied %v, want the skipped object left out", fake.applied)
+	}
+	if len(seen) != 4 {
+		t.Errorf("OnResult saw %v, want every object", seen)
+	}
+}
+
+func TestExecutorObjectTimeout(t *testing.T) {
+	e := &Executor{Client: &fakeApplier{block: true}, Parallel: 2, Timeout: 20 * time.Millisecond}
+	start := time.Now()
+	results := e.Run(context.Background(), [][]Object{testObjects("a", "b")})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("run took %v, want the per-object timeout to end it", elapsed)
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want deadline exceeded", r.Object.Obj.GetName(), r.Err)
+		}
+	}
+}
+
+func TestExecutorParallelBound(t *testing.T) {
+	for _, parallel := range []int{0, 1, 3} {
+		fake := &fakeApplier{delay: 10 * time.Millisecond}
+		e := &Executor{Client: fake, Parallel: parallel}
+		e.Run(context.Background(), [][]Object{testObjects("a", "b", "c", "d", "e", "f", "g", "h")})
+		if want := max(parallel, 1); fake.peak != want {
+			t.Errorf("parallel %d: %d objects applied at once, want %d", parallel, fake.peak, want)
+		}
+	}
+}
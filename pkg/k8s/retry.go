@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// RetryPolicy retries API calls that failed for transient reasons, waiting
+// Backoff, then twice as long each attempt up to MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts int // including the first; 0 or 1 disables retries
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Jitter      float64 // adds up to this fraction of the delay at random
+
+	// Log, when set, is called before each retry
+	Log func(o Object, attempt int, delay time.Duration, err error)
+}
+
+// retry runs call until it succeeds, fails for a reason retrying cannot fix,
+// or runs out of attempts. conflicts marks 409 Conflict as retryable, for
+// calls that read the resourceVersion afresh on each attempt.
+func (p RetryPolicy) retry(ctx context.Context, o Object, conflicts bool, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err, conflicts) {
+			return err
+		}
+
+		delay := p.delay(attempt)
+		// the server may ask for a longer wait, e.g. with Retry-After on 429
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+			delay = time.Duration(seconds) * time.Second
+		}
+		if p.Log != nil {
+			p.Log(o, attempt, delay, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryable reports whether err is a transient API server condition
+func retryable(err error, conflicts bool) bool {
+	switch {
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		// a concurrent writer won the race; only a fresh read helps
+		return conflicts
+	case apierrors.IsTooManyRequests(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		apierrors.IsServiceUnavailable(err):
+		return true
+	case apierrors.IsInternalError(err):
+		// admission webhooks that are restarting or not ready yet
+		return strings.Contains(err.Error(), "failed calling webhook")
+	}
+	return utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
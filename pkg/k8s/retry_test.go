@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+var testGR = schema.GroupResource{Resource: "secrets"}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		conflicts bool
+		want      bool
+	}{
+		{"conflict with server-side apply", apierrors.NewConflict(testGR, "x", errors.New("field owned elsewhere")), false, false},
+		{"conflict with update", apierrors.NewConflict(testGR, "x", errors.New("modified")), true, true},
+		{"already exists with create", apierrors.NewAlreadyExists(testGR, "x"), true, true},
+		{"too many requests", apierrors.NewTooManyRequests("slow down", 1), false, true},
+		{"service unavailable", apierrors.NewServiceUnavailable("restarting"), false, true},
+		{"server timeout", apierrors.NewServerTimeout(testGR, "patch", 1), false, true},
+		{"gateway timeout", apierrors.NewTimeoutError("took too long", 1), false, true},
+		{"webhook not ready", apierrors.NewInternalError(errors.New(`failed calling webhook "x": connection refused`)), false, true},
+		{"other internal error", apierrors.NewInternalError(errors.New("boom")), false, false},
+		{"invalid", apierrors.NewBadRequest("bad spec"), false, false},
+		{"forbidden", apierrors.NewForbidden(testGR, "x", errors.New("rbac")), false, false},
+		{"not found", apierrors.NewNotFound(testGR, "x"), false, false},
+		{"plain error", errors.New("boom"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err, tt.conflicts); got != tt.want {
+				t.Errorf("retryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	unavailable := apierrors.NewServiceUnavailable("restarting")
+	tests := []struct {
+		name      string
+		errs      []error // returned by successive calls; nil after the last
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds after transient errors", []error{unavailable, unavailable}, 5, 3, false},
+		{"gives up after max attempts", []error{unavailable, unavailable, unavailable}, 2, 2, true},
+		{"stops at a permanent error", []error{apierrors.NewBadRequest("bad")}, 5, 1, true},
+		{"retries disabled", []error{unavailable}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RetryPolicy{MaxAttempts: tt.attempts, Backoff: time.Millisecond}
+			calls := 0
+			err := p.retry(context.Background(), Object{}, false, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("calls = %d, err = %v; want %d calls, error %v", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := p.delay(attempt + 1); got != want*time.Millisecond {
+			t.Errorf("attempt %d: delay = %v, want %v", attempt+1, got, want*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		for attempt, base := range []time.Duration{100, 200, 400, 800, 1000} {
+			base *= time.Millisecond
+			if got := p.delay(attempt + 1); got < base || got > base+base/2 {
+				t.Fatalf("attempt %d: delay = %v, want within [%v, %v]", attempt+1, got, base, base+base/2)
+			}
+		}
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var delay time.Duration
+	p := RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		// stop after the first delay is chosen instead of sleeping through it
+		Log: func(_ Object, _ int, d time.Duration, _ error) {
+			delay = d
+			cancel()
+		},
+	}
+	_ = p.retry(ctx, Object{}, false, func() error {
+		return apierrors.NewTooManyRequests("slow down", 7)
+	})
+	if delay != 7*time.Second {
+		t.Errorf("delay = %v, want the 7s the server asked for", delay)
+	}
+}
+
+// A delete whose response was lost is retried; the object being gone by then
+// is success, while a NotFound on the first attempt is not.
+func TestDeleteNotFoundOnRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		codes   []int // answers to successive deletes; the last repeats
+		wantErr bool
+	}{
+		{"gone after a lost response", []int{http.StatusServiceUnavailable, http.StatusNotFound}, false},
+		{"never existed", []int{http.StatusNotFound}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				code := tt.codes[min(calls, len(tt.codes))-1]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":%q,"code":%d}`, reasons[code], code)
+			}))
+			defer srv.Close()
+
+			c, err := NewForConfig(&rest.Config{Host: srv.URL}, Options{Retry: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			o, err := ObjectForDelete("secret", "x", "argocd")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.Delete(context.Background(), o)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !apierrors.IsNotFound(err) {
+				t.Errorf("err = %v, want NotFound", err)
+			}
+		})
+	}
+}
+
+var reasons = map[int]metav1.StatusReason{
+	http.StatusServiceUnavailable: metav1.StatusReasonServiceUnavailable,
+	http.StatusNotFound:           metav1.StatusReasonNotFound,
+}
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// LabelCreatedAt records when rgo first created an object
+	LabelCreatedAt = "created-at"
+	// AnnotationUpdatedAt records when rgo last changed an object
+	AnnotationUpdatedAt = "rgo/updated-at"
+	// AnnotationContentHash is the hash of the content rgo last applied
+	AnnotationContentHash = "rgo/content-hash"
+)
+
+// stamp adds the bookkeeping metadata to a desired object about to be
+// written, given its live version, which is nil when the object does not
+// exist yet
+func stamp(obj, live *unstructured.Unstructured, hash string) {
+	now := time.Now().UTC()
+	// label values cannot contain colons
+	createdAt := now.Format("2006-01-02T15-04-05")
+	if live != nil && live.GetLabels()[LabelCreatedAt] != "" {
+		createdAt = live.GetLabels()[LabelCreatedAt]
+	}
+	setStamp(obj, createdAt, now.Format(time.RFC3339), hash)
+}
+
+// carryStamp copies the bookkeeping metadata of the live object to the
+// desired one, so comparing the two sees only changes to the content
+func carryStamp(obj, live *unstructured.Unstructured) {
+	annotations := live.GetAnnotations()
+	setStamp(obj, live.GetLabels()[LabelCreatedAt], annotations[AnnotationUpdatedAt], annotations[AnnotationContentHash])
+}
+
+func setStamp(obj *unstructured.Unstructured, createdAt, updatedAt, hash string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelCreatedAt] = createdAt
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationUpdatedAt] = updatedAt
+	annotations[AnnotationContentHash] = hash
+	obj.SetAnnotations(annotations)
+}
+
+// sameAsLive reports whether a dry-run write of the desired object leaves the
+// live object as it is. Fields that change on every write are ignored.
+func sameAsLive(dryRun, live *unstructured.Unstructured) bool {
+	strip := func(u *unstructured.Unstructured) map[string]interface{} {
+		u = u.DeepCopy()
+		u.SetManagedFields(nil)
+		u.SetResourceVersion("")
+		return u.Object
+	}
+	return reflect.DeepEqual(strip(dryRun), strip(live))
+}
+
+// contentHash hashes an object as built, without the metadata stamp adds, so
+// retries and re-runs of an unchanged config hash the same
+func contentHash(obj *unstructured.Unstructured) (string, error) {
+	u, err := CopyObject(obj)
+	if err != nil {
+		return "", err
+	}
+	// an emptied map is dropped, so a retry of a stamped object hashes the
+	// same as the object before its first attempt
+	labels := u.GetLabels()
+	delete(labels, LabelCreatedAt)
+	if len(labels) == 0 {
+		labels = nil
+	}
+	u.SetLabels(labels)
+	annotations := u.GetAnnotations()
+	delete(annotations, AnnotationUpdatedAt)
+	delete(annotations, AnnotationContentHash)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	u.SetAnnotations(annotations)
+	u.SetResourceVersion("")
+
+	// encoding/json sorts map keys, so equal content gives equal bytes
+	b, err := json.Marshal(u.Object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
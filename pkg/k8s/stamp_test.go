@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testApp(path string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"managed-by": "rgo"},
+		},
+		"spec": map[string]interface{}{"source": map[string]interface{}{"path": path}},
+	}}
+}
+
+func TestContentHashIgnoresStamp(t *testing.T) {
+	built := testApp("web")
+	want, err := contentHash(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamped := testApp("web")
+	stamp(stamped, nil, want)
+	stamped.SetResourceVersion("42")
+	if got, _ := contentHash(stamped); got != want {
+		t.Error("stamped object hashes differently from the built one")
+	}
+
+	// the stamp is the only label: removing it must not leave an empty map
+	bare := testApp("web")
+	bare.SetLabels(nil)
+	bareHash, _ := contentHash(bare)
+	stamp(bare, nil, bareHash)
+	if got, _ := contentHash(bare); got != bareHash {
+		t.Error("object stamped without labels of its own hashes differently")
+	}
+
+	if got, _ := contentHash(testApp("api")); got == want {
+		t.Error("changed spec hashes the same")
+	}
+	labelled := testApp("web")
+	labelled.SetLabels(map[string]string{"managed-by": "rgo", "team": "a"})
+	if got, _ := contentHash(labelled); got == want {
+		t.Error("added label hashes the same")
+	}
+}
+
+func TestStampKeepsCreatedAt(t *testing.T) {
+	live := testApp("web")
+	live.SetLabels(map[string]string{"managed-by": "rgo", LabelCreatedAt: "2025-01-02T03-04-05"})
+
+	obj := testApp("api")
+	stamp(obj, live, "hash")
+	if got := obj.GetLabels()[LabelCreatedAt]; got != "2025-01-02T03-04-05" {
+		t.Errorf("created-at = %q, want the live value", got)
+	}
+	if got := obj.GetAnnotations()[AnnotationContentHash]; got != "hash" {
+		t.Errorf("content hash = %q, want hash", got)
+	}
+	updated, err := time.Parse(time.RFC3339, obj.GetAnnotations()[AnnotationUpdatedAt])
+	if err != nil || time.Since(updated) > time.Minute {
+		t.Errorf("updated-at = %q, want now", obj.GetAnnotations()[AnnotationUpdatedAt])
+	}
+
+	created := testApp("web")
+	stamp(created, nil, "hash")
+	if _, err := time.Parse("2006-01-02T15-04-05", created.GetLabels()[LabelCreatedAt]); err != nil {
+		t.Errorf("created-at of a new object = %q: %v", created.GetLabels()[LabelCreatedAt], err)
+	}
+}
+
+func TestCarryStamp(t *testing.T) {
+	live := testApp("web")
+	stamp(live, nil, "hash")
+	live.SetLabels(map[string]string{"managed-by": "rgo", LabelCreatedAt: "2025-01-02T03-04-05"})
+
+	obj := testApp("web")
+	carryStamp(obj, live)
+	if got := obj.GetLabels()[LabelCreatedAt]; got != "2025-01-02T03-04-05" {
+		t.Errorf("created-at = %q, want the live value", got)
+	}
+	for _, key := range []string{AnnotationUpdatedAt, AnnotationContentHash} {
+		if got, want := obj.GetAnnotations()[key], live.GetAnnotations()[key]; got != want {
+			t.Errorf("%s = %q, want the live value %q", key, got, want)
+		}
+	}
+}
+
+func TestSameAsLive(t *testing.T) {
+	live := testApp("web")
+	live.SetResourceVersion("41")
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "rgo", Operation: metav1.ManagedFieldsOperationApply}})
+
+	dryRun := testApp("web")
+	dryRun.SetResourceVersion("42")
+	dryRun.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "rgo", Operation: metav1.ManagedFieldsOperationApply, Time: &metav1.Time{Time: time.Now()}}})
+	if !sameAsLive(dryRun, live) {
+		t.Error("resourceVersion and managedFields changes counted as a change")
+	}
+
+	edited := testApp("api")
+	if sameAsLive(edited, live) {
+		t.Error("spec change not detected")
+	}
+
+	annotated := testApp("web")
+	annotated.SetAnnotations(map[string]string{"note": "x"})
+	if sameAsLive(annotated, live) {
+		t.Error("metadata change not detected")
+	}
+
+	// the comparison must not touch the objects it is given
+	if live.GetResourceVersion() != "41" || len(dryRun.GetManagedFields()) != 1 {
+		t.Error("sameAsLive modified its arguments")
+	}
+}